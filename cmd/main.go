@@ -1,19 +1,30 @@
 package main
 
 import (
+	"flag"
 	"github.com/ptsypyshev/simple-blog/internal/blog"
+	"github.com/ptsypyshev/simple-blog/internal/config"
 	"log"
+	"os"
 )
 
 func main() {
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	a := blog.App{}
-	if closer, err := a.Init(); err != nil {
+	if err := a.Init(cfg); err != nil {
 		log.Fatal(err)
-	} else {
-		defer closer.Close()
 	}
 
-	if err := a.Serve(); err != nil {
+	// The pool is closed and traces are flushed after requests are drained
+	err = a.Serve()
+	if cerr := a.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/blog"
+	"github.com/ptsypyshev/simple-blog/internal/config"
+	"github.com/ptsypyshev/simple-blog/internal/db/migrations"
+	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
+	"log"
+	"os"
+)
+
+// Usage: migrate [-steps N] [config flags] up|down|status
+func main() {
+	steps := flag.Int("steps", 1, "number of migrations to revert with down")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	logger, err := blog.NewLogger(cfg.Log)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = logger.Sync() }()
+
+	db, err := pgdb.InitDB(ctx, cfg.DB, logger)
+	if err != nil {
+		log.Fatalf("cannot init DB: %s", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrations.NewMigrator(db, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch flag.Arg(0) {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d migrations applied\n", applied)
+	case "down":
+		reverted, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d migrations reverted\n", reverted)
+	case "status":
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d of %d migrations pending\n", len(pending), len(migrator.Migrations()))
+		for _, mig := range pending {
+			fmt.Printf("  %04d_%s\n", mig.Version, mig.Name)
+		}
+	default:
+		log.Fatalf("unknown command %q, expected up, down or status", flag.Arg(0))
+	}
+}
@@ -0,0 +1,142 @@
+package apperr
+
+import (
+	"errors"
+	"net/http"
+)
+
+type Kind string
+
+const (
+	KindInternal        Kind = "internal"
+	KindBadRequest      Kind = "bad_request"
+	KindNotFound        Kind = "not_found"
+	KindConflict        Kind = "conflict"
+	KindValidation      Kind = "validation"
+	KindForbidden       Kind = "forbidden"
+	KindUnauthenticated Kind = "unauthenticated"
+)
+
+// Sentinels of every kind, errors.Is(err, apperr.ErrNotFound) holds for any *Error of that kind
+var (
+	ErrInternal        = errors.New("internal error")
+	ErrBadRequest      = errors.New("bad request")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrValidation      = errors.New("validation failed")
+	ErrForbidden       = errors.New("forbidden")
+	ErrUnauthenticated = errors.New("unauthenticated")
+)
+
+var sentinels = map[Kind]error{
+	KindInternal:        ErrInternal,
+	KindBadRequest:      ErrBadRequest,
+	KindNotFound:        ErrNotFound,
+	KindConflict:        ErrConflict,
+	KindValidation:      ErrValidation,
+	KindForbidden:       ErrForbidden,
+	KindUnauthenticated: ErrUnauthenticated,
+}
+
+var statuses = map[Kind]int{
+	KindInternal:        http.StatusInternalServerError,
+	KindBadRequest:      http.StatusBadRequest,
+	KindNotFound:        http.StatusNotFound,
+	KindConflict:        http.StatusConflict,
+	KindValidation:      http.StatusUnprocessableEntity,
+	KindForbidden:       http.StatusForbidden,
+	KindUnauthenticated: http.StatusUnauthorized,
+}
+
+// Error is a domain error. Code is a machine-readable reason, e.g. "unique_violation" or "not_owner".
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Details map[string]interface{}
+	Err     error
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func Wrap(err error, kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return sentinels[e.Kind] == target
+}
+
+// WithDetails returns a copy of e with an extra detail.
+func (e *Error) WithDetails(key string, value interface{}) *Error {
+	res := *e
+	res.Details = make(map[string]interface{}, len(e.Details)+1)
+	for k, v := range e.Details {
+		res.Details[k] = v
+	}
+	res.Details[key] = value
+	return &res
+}
+
+func NotFound(code, message string) *Error {
+	return New(KindNotFound, code, message)
+}
+
+func Conflict(code, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+func Validation(code, message string) *Error {
+	return New(KindValidation, code, message)
+}
+
+func BadRequest(code, message string) *Error {
+	return New(KindBadRequest, code, message)
+}
+
+func Forbidden(code, message string) *Error {
+	return New(KindForbidden, code, message)
+}
+
+func Unauthenticated(code, message string) *Error {
+	return New(KindUnauthenticated, code, message)
+}
+
+// From returns the domain error in the chain of err. Errors wrapping only a sentinel
+// (fmt.Errorf("%w: user id 1", apperr.ErrNotFound)) get a generic one of that kind.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	for kind, sentinel := range sentinels {
+		if errors.Is(err, sentinel) {
+			return Wrap(err, kind, string(kind), err.Error())
+		}
+	}
+	return Wrap(err, KindInternal, string(KindInternal), "internal error")
+}
+
+func KindOf(err error) Kind {
+	return From(err).Kind
+}
+
+func Status(kind Kind) int {
+	if status, ok := statuses[kind]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+)
+
+type ctxKey int
+
+const (
+	userKey ctxKey = iota
+	userIDKey
+)
+
+// WithUser returns a copy of ctx carrying the authenticated user.
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// UserFromContext returns the authenticated user if there is one.
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(userKey).(*models.User)
+	return user, ok && user != nil
+}
+
+// WithUserID returns a copy of ctx carrying the id of the user authenticated by a token.
+func WithUserID(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, userIDKey, id)
+}
+
+// UserID returns the id of the authenticated user, no matter how it was authenticated.
+func UserID(ctx context.Context) (int, bool) {
+	if user, ok := UserFromContext(ctx); ok {
+		return user.Id, true
+	}
+	id, ok := ctx.Value(userIDKey).(int)
+	return id, ok
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/ptsypyshev/simple-blog/internal/config"
+	"os"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Signer issues and verifies access tokens signed with HS256 or RS256.
+type Signer struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	issuer    string
+	ttl       time.Duration
+}
+
+func NewSigner(cfg config.JWT) (*Signer, error) {
+	s := &Signer{
+		issuer: cfg.Issuer,
+		ttl:    cfg.AccessTTL.Duration,
+	}
+	switch cfg.Algorithm {
+	case "HS256":
+		s.method = jwt.SigningMethodHS256
+		s.signKey = []byte(cfg.Secret)
+		s.verifyKey = []byte(cfg.Secret)
+	case "RS256":
+		pem, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read private key: %w", err)
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse private key: %w", err)
+		}
+		s.method = jwt.SigningMethodRS256
+		s.signKey = key
+		s.verifyKey = &key.PublicKey
+	default:
+		return nil, fmt.Errorf("unknown jwt algorithm %q", cfg.Algorithm)
+	}
+	return s, nil
+}
+
+// Sign returns an access token for the user and its expiration time.
+func (s *Signer) Sign(userID int) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.ttl)
+	claims := jwt.RegisteredClaims{
+		Issuer:    s.issuer,
+		Subject:   strconv.Itoa(userID),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+	token, err := jwt.NewWithClaims(s.method, claims).SignedString(s.signKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot sign token: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+// Verify checks the signature, the algorithm and the claims of a token and returns the user id.
+func (s *Signer) Verify(token string) (int, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		// Otherwise a token signed with the public key as HMAC secret would pass
+		if t.Method.Alg() != s.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		return s.verifyKey, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	if !claims.VerifyIssuer(s.issuer, s.issuer != "") {
+		return 0, fmt.Errorf("%w: bad issuer", ErrInvalidToken)
+	}
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad subject", ErrInvalidToken)
+	}
+	return id, nil
+}
+
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
@@ -2,97 +2,338 @@ package blog
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+
 	"github.com/jackc/pgx/v4/pgxpool"
-	"github.com/opentracing/opentracing-go"
+	"github.com/ptsypyshev/simple-blog/internal/auth"
 	"github.com/ptsypyshev/simple-blog/internal/blog/handlers"
+	"github.com/ptsypyshev/simple-blog/internal/config"
+	"github.com/ptsypyshev/simple-blog/internal/db/categorystore"
 	"github.com/ptsypyshev/simple-blog/internal/db/commentstore"
+	"github.com/ptsypyshev/simple-blog/internal/db/migrations"
 	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
 	"github.com/ptsypyshev/simple-blog/internal/db/poststore"
+	"github.com/ptsypyshev/simple-blog/internal/db/searchstore"
+	"github.com/ptsypyshev/simple-blog/internal/db/sessionstore"
+	"github.com/ptsypyshev/simple-blog/internal/db/spamstore"
+	"github.com/ptsypyshev/simple-blog/internal/db/tagstore"
+	"github.com/ptsypyshev/simple-blog/internal/db/tokenstore"
 	"github.com/ptsypyshev/simple-blog/internal/db/userstore"
+	"github.com/ptsypyshev/simple-blog/internal/health"
+	"github.com/ptsypyshev/simple-blog/internal/metrics"
+	"github.com/ptsypyshev/simple-blog/internal/policy"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/authrepo"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/categoryrepo"
 	"github.com/ptsypyshev/simple-blog/internal/repositories/commentrepo"
 	"github.com/ptsypyshev/simple-blog/internal/repositories/postrepo"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/searchrepo"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/spamrepo"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/tagrepo"
 	"github.com/ptsypyshev/simple-blog/internal/repositories/userrepo"
-	"log"
 
-	//nice "github.com/ekyoung/gin-nice-recovery"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/zap"
-	"io"
 )
 
 type App struct {
-	db       *pgxpool.Pool
-	users    userrepo.Users
-	posts    postrepo.Posts
-	comments commentrepo.Comments
-	logger   *zap.Logger
-	tracer   opentracing.Tracer
+	cfg        *config.Config
+	db         *pgxpool.Pool
+	migrator   *migrations.Migrator
+	users      userrepo.Users
+	posts      postrepo.Posts
+	comments   commentrepo.Comments
+	search     searchrepo.Search
+	tags       tagrepo.Tags
+	categories categoryrepo.Categories
+	auth       authrepo.Auth
+	logger     *zap.Logger
+	tracing    io.Closer
 }
 
-func (a *App) Init() (io.Closer, error) {
+func (a *App) Init(cfg *config.Config) error {
 	ctx := context.Background()
-	logger, err := zap.NewDevelopment()
+	logger, err := NewLogger(cfg.Log)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer func() { _ = logger.Sync() }()
-	tracer, closer := InitJaeger(logger)
-	//tracer, closer := InitJaeger("App", "localhost:6831", logger)
+	tracing, err := InitTracing(cfg.Tracing, logger)
+	if err != nil {
+		return err
+	}
 
-	db, err := pgdb.InitDB(ctx, logger, tracer)
+	db, err := pgdb.InitDB(ctx, cfg.DB, logger)
 	if err != nil {
-		log.Fatalf("cannot init DB: %s", err)
+		return fmt.Errorf("cannot init DB: %w", err)
+	}
+
+	metrics.Registry.MustRegister(metrics.NewPoolCollector(db))
+
+	migrator, err := migrations.NewMigrator(db, logger)
+	if err != nil {
+		return err
+	}
+	if cfg.DB.AutoMigrate {
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("cannot apply migrations: %w", err)
+		}
+		logger.Info("schema is up to date", zap.Int("applied migrations", applied))
 	}
 
-	ustore := userstore.NewUsersDB(db, logger, tracer)
-	pstore := poststore.NewPostsDB(db, logger, tracer)
-	cstore := commentstore.NewCommentsDB(db, logger, tracer)
+	ustore := userstore.NewUsersDB(db, logger)
+	pstore := poststore.NewPostsDB(db, logger)
+	cstore := commentstore.NewCommentsDB(db, logger)
+	metrics.Registry.MustRegister(metrics.NewPendingCollector(cstore.CountPending))
+	sstore := sessionstore.NewSessionsDB(db, logger)
+	tstore := tokenstore.NewRefreshTokensDB(db, logger)
+	fstore := searchstore.NewSearchDB(db, logger)
+	gstore := tagstore.NewTagsDB(db, logger)
+	kstore := categorystore.NewCategoriesDB(db, logger)
+	mstore := spamstore.NewSpamDB(db, logger)
 
+	search := searchrepo.NewSearch(fstore, logger)
+	if err := search.SetLanguage(ctx, cfg.Search.Language); err != nil {
+		return err
+	}
+
+	// Spam checks are skipped when the filter is nil
+	var spam commentrepo.SpamFilter
+	if cfg.Spam.Enabled {
+		if spam, err = spamrepo.NewScorer(mstore, cfg.Spam, logger); err != nil {
+			return fmt.Errorf("cannot init spam filter: %w", err)
+		}
+	}
+
+	signer, err := auth.NewSigner(cfg.Auth.JWT)
+	if err != nil {
+		return fmt.Errorf("cannot init token signer: %w", err)
+	}
+
+	a.cfg = cfg
 	a.logger = logger
-	a.tracer = tracer
 	a.db = db
-	a.users = *userrepo.NewUsers(ustore, logger, tracer)
-	a.posts = *postrepo.NewPosts(pstore, logger, tracer)
-	a.comments = *commentrepo.NewComments(cstore, logger, tracer)
+	a.migrator = migrator
+	a.users = *userrepo.NewUsers(ustore, logger)
+	a.posts = *postrepo.NewPosts(pstore, logger)
+	a.comments = *commentrepo.NewComments(cstore, spam, cfg.Comments, logger)
+	a.search = *search
+	a.tags = *tagrepo.NewTags(gstore, logger)
+	a.categories = *categoryrepo.NewCategories(kstore, logger)
+	a.auth = *authrepo.NewAuth(ustore, sstore, tstore, signer, cfg.Auth, logger)
+	a.tracing = tracing
 
-	return closer, nil
+	return nil
 }
 
+// Serve serves requests until SIGINT or SIGTERM. Then in-flight requests are drained
+// and background workers are stopped, Close releases the rest.
 func (a *App) Serve() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Background workers live as long as the server
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var wg sync.WaitGroup
+	scheduler := postrepo.NewScheduler(&a.posts, a.cfg.Posts.PublishInterval.Duration, a.logger)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scheduler.Run(workers)
+	}()
+
 	////Initialize Handlers
-	userHandlers := blog.NewUserHandlers(a.users, a.logger, a.tracer)
-	postHandlers := blog.NewPostHandlers(a.posts, a.logger, a.tracer)
-	commentHandlers := blog.NewCommentHandlers(a.comments, a.logger, a.tracer)
-	defaultHandlers := blog.NewDefaultHandlers(a.db, a.logger, a.tracer)
-	//panicHandler := handler.NewPanicHandler(a.logger, a.tracer)
+	pol := policy.New(a.users)
+	userHandlers := blog.NewUserHandlers(*policy.NewUsers(a.users, pol))
+	posts := policy.NewPosts(a.posts, pol)
+	postHandlers := blog.NewPostHandlers(*posts)
+	commentHandlers := blog.NewCommentHandlers(*policy.NewComments(a.comments, posts, pol))
+	searchHandlers := blog.NewSearchHandlers(*policy.NewSearch(a.search, pol))
+	tagHandlers := blog.NewTagHandlers(*policy.NewTags(a.tags, pol))
+	categoryHandlers := blog.NewCategoryHandlers(*policy.NewCategories(a.categories, pol))
+	demo := a.cfg.Demo
+	if demo.Enabled && demo.AdminPassword == "" {
+		password, err := newDemoPassword()
+		if err != nil {
+			return err
+		}
+		demo.AdminPassword = password
+		// Shown once, the redacting logger would hide a field named after a password
+		a.logger.Warn(fmt.Sprintf("demo admin password is generated: %s", password))
+	}
+	defaultHandlers := blog.NewDefaultHandlers(a.db, a.migrator, demo)
+	authHandlers := blog.NewAuthHandlers(a.auth, a.cfg.Auth)
+	healthHandlers := blog.NewHealthHandlers([]health.Check{
+		{Name: "db", Run: a.db.Ping},
+		{Name: "migrations", Run: a.migrator.Check},
+		// Traces are lost while the collector is down, but requests are still served
+		{Name: "tracing", Optional: true, Run: TracingCheck(a.cfg.Tracing)},
+	}, a.cfg.Health.Timeout.Duration)
 
 	//Initialize Router and add Middleware
-	router := gin.Default()
-	router.Static("/assets", "./assets")
-	//router.Use(nice.Recovery(panicHandler.RecoveryHandler))
-	router.LoadHTMLGlob("assets/**/*")
+	router := gin.New()
+	// Values of the request context (e.g. the current user) are reachable through *gin.Context
+	router.ContextWithFallback = true
+	// Every route gets a span continuing the trace of the caller from the traceparent header,
+	// a request id, an access log line and recovery from panics
+	router.Use(
+		otelgin.Middleware(a.cfg.Tracing.ServiceName),
+		blog.RequestID(),
+		blog.AccessLog(a.logger),
+	)
+	// Metrics see statuses of recovered panics and rendered errors
+	if a.cfg.Metrics.Enabled {
+		router.Use(blog.Metrics())
+	}
+	router.Use(blog.Recovery(a.logger))
+	router.Static("/assets", a.cfg.Assets.Dir)
+	router.LoadHTMLGlob(a.cfg.Assets.Templates)
 
 	//Routes
 
+	router.GET("/healthz", healthHandlers.Healthz)
+	router.GET("/readyz", healthHandlers.Readyz)
+	if a.cfg.Metrics.Enabled {
+		router.GET(a.cfg.Metrics.Path, blog.MetricsHandler())
+	}
+	// Errors goes before other middlewares of routes to render their errors
+	router.Use(blog.Errors())
+	router.Use(authHandlers.Authenticate)
+	// Mutating routes are available for authenticated users only
+	authorized := router.Group("/", authHandlers.RequireAuth)
+
 	router.GET("/", defaultHandlers.Index)
-	router.GET("/dbinit/", defaultHandlers.InitSchema)
-	router.GET("/demodb/", defaultHandlers.AddDemoData)
+	// Demo routes change the DB for anyone, they are off unless enabled explicitly
+	if a.cfg.Demo.Enabled {
+		a.logger.Warn("demo routes /dbinit/ and /demodb/ are enabled")
+		router.GET("/dbinit/", defaultHandlers.InitSchema)
+		router.GET("/demodb/", defaultHandlers.AddDemoData)
+	}
+
+	router.POST("/login", authHandlers.Login)
+	router.POST("/logout", authHandlers.Logout)
+	router.POST("/auth/token", authHandlers.Token)
 
+	router.GET("/users/", userHandlers.ListUsers)
 	router.GET("/users/:id", userHandlers.GetUser)
-	router.POST("/users/", userHandlers.CreateUser)
-	router.PUT("/users/", userHandlers.UpdateUser)
-	router.DELETE("/users/:id", userHandlers.DeleteUser)
+	authorized.POST("/users/", userHandlers.CreateUser)
+	authorized.PUT("/users/", userHandlers.UpdateUser)
+	authorized.PATCH("/users/", userHandlers.UpdateUser)
+	authorized.DELETE("/users/:id", userHandlers.DeleteUser)
+	router.GET("/users/:id/posts", postHandlers.ListUserPosts)
 
+	router.GET("/posts/", postHandlers.ListPosts)
 	router.GET("/posts/:id", postHandlers.GetPost)
-	router.POST("/posts/", postHandlers.CreatePost)
-	router.PUT("/posts/", postHandlers.UpdatePost)
-	router.DELETE("/posts/:id", postHandlers.DeletePost)
+	router.GET("/posts/by-slug/:slug", postHandlers.GetPostBySlug)
+	authorized.POST("/posts/", postHandlers.CreatePost)
+	authorized.PUT("/posts/", postHandlers.UpdatePost)
+	authorized.PATCH("/posts/", postHandlers.UpdatePost)
+	authorized.DELETE("/posts/:id", postHandlers.DeletePost)
+	router.GET("/posts/:id/comments", commentHandlers.ListPostComments)
+	router.GET("/posts/:id/comments/tree", commentHandlers.ListPostCommentTree)
+	authorized.GET("/posts/:id/revisions", postHandlers.ListPostRevisions)
+	authorized.GET("/posts/:id/revisions/diff", postHandlers.DiffPostRevisions)
+	authorized.GET("/posts/:id/revisions/:rev", postHandlers.GetPostRevision)
+	authorized.POST("/posts/:id/revisions/:rev/restore", postHandlers.RestorePostRevision)
+	authorized.POST("/posts/:id/comments", commentHandlers.CreateComment)
 
+	router.GET("/comments/", commentHandlers.ListComments)
 	router.GET("/comments/:id", commentHandlers.GetComment)
-	router.POST("/comments/", commentHandlers.CreateComment)
-	router.PUT("/comments/", commentHandlers.UpdateComment)
-	router.DELETE("/comments/:id", commentHandlers.DeleteComment)
+	authorized.POST("/comments/", commentHandlers.CreateComment)
+	authorized.PUT("/comments/", commentHandlers.UpdateComment)
+	authorized.PATCH("/comments/", commentHandlers.UpdateComment)
+	authorized.DELETE("/comments/:id", commentHandlers.DeleteComment)
+
+	authorized.GET("/moderation/comments", commentHandlers.ListModerationQueue)
+	authorized.POST("/moderation/comments", commentHandlers.ModerateComments)
+	authorized.GET("/moderation/log", commentHandlers.ListModerationLog)
+
+	router.GET("/tags/", tagHandlers.ListTags)
+	router.GET("/tags/:slug", tagHandlers.GetTag)
+	authorized.POST("/tags/", tagHandlers.CreateTag)
+	authorized.PUT("/tags/", tagHandlers.UpdateTag)
+	authorized.PATCH("/tags/", tagHandlers.UpdateTag)
+	authorized.DELETE("/tags/:id", tagHandlers.DeleteTag)
+	router.GET("/tags/:slug/posts", postHandlers.ListTagPosts)
+
+	router.GET("/categories/", categoryHandlers.ListCategories)
+	router.GET("/categories/:slug", categoryHandlers.GetCategory)
+	authorized.POST("/categories/", categoryHandlers.CreateCategory)
+	authorized.PUT("/categories/", categoryHandlers.UpdateCategory)
+	authorized.PATCH("/categories/", categoryHandlers.UpdateCategory)
+	authorized.DELETE("/categories/:id", categoryHandlers.DeleteCategory)
+	router.GET("/categories/:slug/posts", postHandlers.ListCategoryPosts)
+
+	router.GET("/search", searchHandlers.Search)
 
 	// Start serving the application
-	return router.Run()
+	srv := &http.Server{
+		Addr:              a.cfg.HTTP.Addr,
+		Handler:           router,
+		ReadTimeout:       a.cfg.HTTP.ReadTimeout.Duration,
+		ReadHeaderTimeout: a.cfg.HTTP.ReadHeaderTimeout.Duration,
+		WriteTimeout:      a.cfg.HTTP.WriteTimeout.Duration,
+		IdleTimeout:       a.cfg.HTTP.IdleTimeout.Duration,
+		MaxHeaderBytes:    a.cfg.HTTP.MaxHeaderBytes,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		a.logger.Info("serving HTTP", zap.String("addr", srv.Addr))
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+		err = fmt.Errorf("cannot serve HTTP: %w", err)
+	case <-ctx.Done():
+		// A second signal kills the process right away
+		stop()
+		a.logger.Info("shutting down, draining in-flight requests",
+			zap.Duration("timeout", a.cfg.HTTP.ShutdownTimeout.Duration))
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), a.cfg.HTTP.ShutdownTimeout.Duration)
+		defer cancel()
+		if err = srv.Shutdown(shutdownCtx); err != nil {
+			err = fmt.Errorf("cannot drain HTTP connections: %w", err)
+		}
+	}
+
+	stopWorkers()
+	wg.Wait()
+	a.logger.Info("background workers stopped")
+	return err
+}
+
+// newDemoPassword makes a password for the demo admin, when none is configured
+func newDemoPassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot generate demo admin password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Close closes the DB pool and flushes traces, it goes after Serve returns.
+func (a *App) Close() error {
+	if a.db != nil {
+		a.db.Close()
+		a.logger.Info("DB pool closed")
+	}
+	var err error
+	if a.tracing != nil {
+		if err = a.tracing.Close(); err != nil {
+			err = fmt.Errorf("cannot flush traces: %w", err)
+		}
+	}
+	_ = a.logger.Sync()
+	return err
 }
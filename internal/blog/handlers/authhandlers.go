@@ -0,0 +1,216 @@
+package blog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/auth"
+	"github.com/ptsypyshev/simple-blog/internal/config"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/authrepo"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CSRFHeader carries the CSRF token of the session, it is required for unsafe methods
+// of requests authenticated with the session cookie.
+const CSRFHeader = "X-CSRF-Token"
+
+// csrfCookie is readable by scripts of the site, which echo it in CSRFHeader
+const csrfCookie = "csrf_token"
+
+var errBadCSRF = apperr.Forbidden("csrf_token_mismatch", "missing or invalid CSRF token")
+
+type credentials struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type tokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type authHandlers struct {
+	authrepo authrepo.Auth
+	cfg      config.Auth
+}
+
+func NewAuthHandlers(a authrepo.Auth, cfg config.Auth) authHandlers {
+	return authHandlers{
+		authrepo: a,
+		cfg:      cfg,
+	}
+}
+
+func (h authHandlers) Login(c *gin.Context) {
+	var cred credentials
+	if err := c.ShouldBindJSON(&cred); err != nil {
+		_ = c.Error(badJSON(err))
+		return
+	}
+	session, user, err := h.authrepo.Login(c, cred.Username, cred.Password)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	maxAge := int(time.Until(session.ExpiresAt).Seconds())
+	csrf := csrfToken(session.Token)
+	h.setCookie(c, session.Token, maxAge)
+	h.setCSRFCookie(c, csrf, maxAge)
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":    user.Id,
+		"username":   user.Username,
+		"expires_at": session.ExpiresAt,
+		"csrf_token": csrf,
+	})
+}
+
+func (h authHandlers) Logout(c *gin.Context) {
+	if token, err := c.Cookie(h.cfg.CookieName); err == nil && token != "" {
+		if err := h.authrepo.Logout(c, token); err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+	h.setCookie(c, "", -1)
+	h.setCSRFCookie(c, "", -1)
+	c.Status(http.StatusNoContent)
+}
+
+// Token exchanges username/password (grant_type "password", the default)
+// or a refresh token (grant_type "refresh_token") for an access token.
+func (h authHandlers) Token(c *gin.Context) {
+	var req tokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(badJSON(err))
+		return
+	}
+
+	var (
+		pair *models.TokenPair
+		err  error
+	)
+	switch req.GrantType {
+	case "", "password":
+		if req.Username == "" || req.Password == "" {
+			_ = c.Error(apperr.Validation("invalid_body", "username and password are required"))
+			return
+		}
+		pair, err = h.authrepo.IssueToken(c, req.Username, req.Password)
+	case "refresh_token":
+		if req.RefreshToken == "" {
+			_ = c.Error(apperr.Validation("invalid_body", "refresh_token is required"))
+			return
+		}
+		pair, err = h.authrepo.RefreshToken(c, req.RefreshToken)
+	default:
+		_ = c.Error(apperr.BadRequest("unsupported_grant_type", fmt.Sprintf("unsupported grant_type %q", req.GrantType)))
+		return
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, pair)
+}
+
+// Authenticate is a middleware which puts the current user into the request context.
+// A bearer token gives the user id, a session cookie gives the whole user.
+// Requests without credentials go on anonymously, invalid bearer tokens are rejected.
+// Browsers send the cookie with cross-site requests too, so unsafe methods authenticated
+// with it need the CSRF token of the session in CSRFHeader.
+func (h authHandlers) Authenticate(c *gin.Context) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		token := strings.TrimPrefix(header, "Bearer ")
+		if token == header {
+			_ = c.Error(apperr.Unauthenticated("unsupported_scheme", "unsupported authorization scheme"))
+			c.Abort()
+			return
+		}
+		id, err := h.authrepo.VerifyAccessToken(token)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Request = c.Request.WithContext(auth.WithUserID(c.Request.Context(), id))
+		c.Next()
+		return
+	}
+
+	token, err := c.Cookie(h.cfg.CookieName)
+	if err != nil || token == "" {
+		c.Next()
+		return
+	}
+	user, err := h.authrepo.Authenticate(c.Request.Context(), token)
+	if errors.Is(err, authrepo.ErrInvalidSession) {
+		h.setCookie(c, "", -1)
+		h.setCSRFCookie(c, "", -1)
+		c.Next()
+		return
+	}
+	if err != nil {
+		_ = c.Error(err)
+		c.Abort()
+		return
+	}
+	if !safeMethod(c.Request.Method) && !validCSRF(token, c.GetHeader(CSRFHeader)) {
+		_ = c.Error(errBadCSRF)
+		c.Abort()
+		return
+	}
+	c.Request = c.Request.WithContext(auth.WithUser(c.Request.Context(), user))
+	c.Next()
+}
+
+// RequireAuth is a middleware which rejects anonymous requests.
+func (h authHandlers) RequireAuth(c *gin.Context) {
+	if _, ok := auth.UserID(c.Request.Context()); !ok {
+		_ = c.Error(errAuthRequired)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func (h authHandlers) setCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(h.cfg.CookieName, value, maxAge, "/", h.cfg.CookieDomain, h.cfg.CookieSecure, true)
+}
+
+// setCSRFCookie is not HttpOnly, scripts of the site read the token from it after reloads
+func (h authHandlers) setCSRFCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(csrfCookie, value, maxAge, "/", h.cfg.CookieDomain, h.cfg.CookieSecure, false)
+}
+
+// csrfToken is derived from the session token, which other sites can neither read
+// nor set, so a token planted in the CSRF cookie by them does not match.
+func csrfToken(session string) string {
+	mac := hmac.New(sha256.New, []byte(session))
+	mac.Write([]byte("csrf"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func validCSRF(session, token string) bool {
+	return token != "" && hmac.Equal([]byte(token), []byte(csrfToken(session)))
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package blog
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"sort"
+	"strings"
+)
+
+// bindUpdate binds the request JSON into obj and returns the update mask.
+// The mask is taken from the "fields" query param (?fields=last_name,is_active)
+// or, if there is none, from the keys present in the body. Masked fields are
+// updated even when they hold zero values.
+func bindUpdate(c *gin.Context, obj interface{}) ([]string, error) {
+	body, err := c.GetRawData()
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, obj); err != nil {
+		return nil, err
+	}
+	if fields := c.Query("fields"); fields != "" {
+		return strings.Split(fields, ","), nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(raw))
+	for k := range raw {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
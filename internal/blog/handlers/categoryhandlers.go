@@ -0,0 +1,82 @@
+package blog
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/policy"
+	"net/http"
+	"strconv"
+)
+
+type categoryHandlers struct {
+	categoryrepo policy.Categories
+}
+
+func NewCategoryHandlers(r policy.Categories) categoryHandlers {
+	return categoryHandlers{
+		categoryrepo: r,
+	}
+}
+
+func (h categoryHandlers) CreateCategory(c *gin.Context) {
+	var category models.Category
+	if err := c.ShouldBindJSON(&category); err != nil {
+		_ = c.Error(badJSON(err))
+		return
+	}
+	newCategory, err := h.categoryrepo.Create(c, category)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, newCategory)
+}
+
+// GetCategory serves GET /categories/:slug.
+func (h categoryHandlers) GetCategory(c *gin.Context) {
+	category, err := h.categoryrepo.ReadBySlug(c, c.Param("slug"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+func (h categoryHandlers) UpdateCategory(c *gin.Context) {
+	var category models.Category
+	fields, err := bindUpdate(c, &category)
+	if err != nil {
+		_ = c.Error(badJSON(err))
+		return
+	}
+	updatedCategory, err := h.categoryrepo.Update(c, category, fields...)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, updatedCategory)
+}
+
+func (h categoryHandlers) DeleteCategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(badParam("id", err))
+		return
+	}
+	deletedCategory, err := h.categoryrepo.Delete(c, id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, deletedCategory)
+}
+
+// ListCategories serves GET /categories/ with the whole category tree.
+func (h categoryHandlers) ListCategories(c *gin.Context) {
+	tree, err := h.categoryrepo.Tree(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": tree})
+}
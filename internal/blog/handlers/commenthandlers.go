@@ -3,148 +3,154 @@ package blog
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/log"
+	"github.com/ptsypyshev/simple-blog/internal/auth"
 	"github.com/ptsypyshev/simple-blog/internal/models"
-	"github.com/ptsypyshev/simple-blog/internal/repositories/commentrepo"
-	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
+	"github.com/ptsypyshev/simple-blog/internal/policy"
 	"net/http"
 	"strconv"
 )
 
 type commentHandlers struct {
-	commentrepo commentrepo.Comments
-	logger      *zap.Logger
-	tracer      opentracing.Tracer
+	commentrepo policy.Comments
 }
 
-func NewCommentHandlers(c commentrepo.Comments, l *zap.Logger, t opentracing.Tracer) commentHandlers {
+func NewCommentHandlers(c policy.Comments) commentHandlers {
 	return commentHandlers{
 		commentrepo: c,
-		logger:      l,
-		tracer:      t,
 	}
 }
 
 func (h commentHandlers) CreateComment(c *gin.Context) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(c, h.tracer,
-		"commentHandlers.CreateComment")
-	defer span.Finish()
-	h.logger.Info("commentHandlers.CreateComment", zap.Field{Key: "method", String: c.Request.Method, Type: zapcore.StringType})
-	span.SetTag("method", c.Request.Method)
-	span.SetTag("params", c.Params)
 	var comment models.Comment
-	if err := c.BindJSON(&comment); err != nil {
-		h.logger.Error(fmt.Sprintf(`bad json: %s`, err))
-		span.LogFields(
-			log.Error(err),
-		)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err})
-		return
-	}
-	span.LogFields(
-		log.String("Comment request", comment.String()),
-	)
-	newComment, err := h.commentrepo.Create(ctx, comment)
+	if err := c.ShouldBindJSON(&comment); err != nil {
+		_ = c.Error(badJSON(err))
+		return
+	}
+	// POST /posts/:id/comments takes the post from the path
+	if c.Param("id") != "" {
+		postID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			_ = c.Error(badParam("id", err))
+			return
+		}
+		comment.PostId = postID
+	}
+	// The author is the authenticated user, user_id from the body is ignored
+	userID, ok := auth.UserID(c)
+	if !ok {
+		_ = c.Error(errAuthRequired)
+		return
+	}
+	comment.UserId = userID
+	newComment, err := h.commentrepo.Create(c, comment)
 	if err != nil {
-		msg := fmt.Sprintf(`create comment error: %s`, err)
-		h.logger.Error(msg)
-		span.LogFields(log.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		_ = c.Error(err)
 		return
 	}
-	span.LogFields(
-		log.String("comment result", newComment.String()),
-	)
 	c.JSON(http.StatusOK, newComment)
 }
 
 func (h commentHandlers) GetComment(c *gin.Context) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(c, h.tracer,
-		"commentHandlers.GetComment")
-	defer span.Finish()
-	h.logger.Info("commentHandlers.GetComment", zap.Field{Key: "method", String: c.Request.Method, Type: zapcore.StringType})
-	span.SetTag("method", c.Request.Method)
-	span.SetTag("params", c.Params)
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		h.logger.Warn(fmt.Sprintf(`bad param: %s`, err))
-		span.LogFields(log.Error(err))
-		c.String(http.StatusBadRequest, fmt.Sprintf(`bad id: %s`, c.Param("id")))
+		_ = c.Error(badParam("id", err))
 		return
 	}
-	comment, err := h.commentrepo.Read(ctx, id)
+	comment, err := h.commentrepo.Read(c, id)
 	if err != nil {
-		msg := fmt.Sprintf(`get error: %s`, err)
-		h.logger.Warn(msg)
-		span.LogFields(log.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		_ = c.Error(err)
 		return
 	}
-	span.LogFields(
-		log.String("Successfully get comment ", fmt.Sprintf("%v", comment)),
-	)
 	c.JSON(http.StatusOK, comment)
 }
 
 func (h commentHandlers) UpdateComment(c *gin.Context) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(c, h.tracer,
-		"commentHandlers.UpdateComment")
-	defer span.Finish()
-	h.logger.Info("commentHandlers.UpdateComment", zap.Field{Key: "method", String: c.Request.Method, Type: zapcore.StringType})
-	span.SetTag("method", c.Request.Method)
-	span.SetTag("params", c.Params)
 	var comment models.Comment
-	if err := c.BindJSON(&comment); err != nil {
-		h.logger.Error(fmt.Sprintf(`bad json: %s`, err))
-		span.LogFields(
-			log.Error(err),
-		)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err})
-		return
-	}
-	span.LogFields(
-		log.String("Comment request", comment.String()),
-	)
-	updatedComment, err := h.commentrepo.Update(ctx, comment)
+	fields, err := bindUpdate(c, &comment)
 	if err != nil {
-		msg := fmt.Sprintf(`update comment error: %s`, err)
-		h.logger.Error(msg)
-		span.LogFields(log.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		_ = c.Error(badJSON(err))
+		return
+	}
+	updatedComment, err := h.commentrepo.Update(c, comment, fields...)
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
-	span.LogFields(
-		log.String("Comment result", updatedComment.String()),
-	)
 	c.JSON(http.StatusOK, updatedComment)
 }
 
 func (h commentHandlers) DeleteComment(c *gin.Context) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(c, h.tracer,
-		"commentHandlers.DeleteComment")
-	defer span.Finish()
-	h.logger.Info("commentHandlers.DeleteComment", zap.Field{Key: "method", String: c.Request.Method, Type: zapcore.StringType})
-	span.SetTag("method", c.Request.Method)
-	span.SetTag("params", c.Params)
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		h.logger.Warn(fmt.Sprintf(`bad param: %s`, err))
-		span.LogFields(log.Error(err))
-		c.String(http.StatusBadRequest, fmt.Sprintf(`bad id: %s`, c.Param("id")))
+		_ = c.Error(badParam("id", err))
 		return
 	}
-	deletedComment, err := h.commentrepo.Delete(ctx, id)
+	deletedComment, err := h.commentrepo.Delete(c, id)
 	if err != nil {
-		msg := fmt.Sprintf(`delete comment error: %s`, err)
-		h.logger.Error(msg)
-		span.LogFields(log.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		_ = c.Error(err)
 		return
 	}
-	span.LogFields(
-		log.String("Comment result", deletedComment.String()),
-	)
 	c.JSON(http.StatusOK, deletedComment)
 }
+
+func (h commentHandlers) ListComments(c *gin.Context) {
+	params, err := bindList(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	comments, page, err := h.commentrepo.List(c, params)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setLinks(c, params, page)
+	c.JSON(http.StatusOK, listResponse{Items: comments, Page: page})
+}
+
+// ListPostComments serves GET /posts/:id/comments.
+func (h commentHandlers) ListPostComments(c *gin.Context) {
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(badParam("id", err))
+		return
+	}
+	params, err := bindList(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	comments, page, err := h.commentrepo.ListByPost(c, postID, params)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setLinks(c, params, page)
+	c.JSON(http.StatusOK, listResponse{Items: comments, Page: page})
+}
+
+// ListPostCommentTree serves GET /posts/:id/comments/tree?format=nested|flat&sort=oldest|newest|top.
+// Nested format puts replies into their parents, flat format lists every comment
+// followed by its replies with the path of ids from the root comment.
+func (h commentHandlers) ListPostCommentTree(c *gin.Context) {
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(badParam("id", err))
+		return
+	}
+	order := c.DefaultQuery("sort", models.ThreadOldest)
+	var items interface{}
+	switch format := c.DefaultQuery("format", "nested"); format {
+	case "nested":
+		items, err = h.commentrepo.Thread(c, postID, order)
+	case "flat":
+		items, err = h.commentrepo.FlatThread(c, postID, order)
+	default:
+		err = badParam("format", fmt.Errorf("unknown format %q", format))
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
@@ -4,70 +4,48 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v4/pgxpool"
-	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/log"
+	"github.com/ptsypyshev/simple-blog/internal/config"
+	"github.com/ptsypyshev/simple-blog/internal/db/migrations"
 	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
-	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 	"net/http"
 )
 
 type defaultHandlers struct {
-	pool   *pgxpool.Pool
-	logger *zap.Logger
-	tracer opentracing.Tracer
+	pool     *pgxpool.Pool
+	migrator *migrations.Migrator
+	demo     config.Demo
 }
 
-func NewDefaultHandlers(p *pgxpool.Pool, l *zap.Logger, t opentracing.Tracer) defaultHandlers {
+func NewDefaultHandlers(p *pgxpool.Pool, m *migrations.Migrator, demo config.Demo) defaultHandlers {
 	return defaultHandlers{
-		pool:   p,
-		logger: l,
-		tracer: t,
+		pool:     p,
+		migrator: m,
+		demo:     demo,
 	}
 }
 
 func (h defaultHandlers) Index(c *gin.Context) {
-	span, _ := opentracing.StartSpanFromContextWithTracer(c, h.tracer,
-		"defaultHandlers.Index")
-	defer span.Finish()
-	h.logger.Info("defaultHandlers.Index", zap.Field{Key: "method", String: c.Request.Method, Type: zapcore.StringType})
-	span.SetTag("method", c.Request.Method)
-	span.SetTag("params", c.Params)
-
 	c.HTML(http.StatusOK, "main", gin.H{
 		"title":   "Simple Blog API",
 		"h1_text": "Simple Blog API",
+		"demo":    h.demo.Enabled,
 	})
 }
 
 func (h defaultHandlers) InitSchema(c *gin.Context) {
-	span, _ := opentracing.StartSpanFromContextWithTracer(c, h.tracer,
-		"defaultHandlers.InitSchema")
-	defer span.Finish()
-	h.logger.Info("defaultHandlers.InitSchema", zap.Field{Key: "method", String: c.Request.Method, Type: zapcore.StringType})
-	span.SetTag("method", c.Request.Method)
-	span.SetTag("params", c.Params)
-
-	if err := pgdb.InitSchema(c, h.pool); err != nil {
-		h.logger.Error(fmt.Sprintf(`cannot init schema: %s`, err))
-		span.LogFields(log.Error(err))
-		c.String(http.StatusInternalServerError, "DB is not initialized")
+	// Only pending migrations are applied, existing data is kept
+	applied, err := h.migrator.Up(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
 	}
-	c.String(http.StatusOK, "DB Initialized")
+	c.String(http.StatusOK, fmt.Sprintf("DB Initialized, %d migrations applied", applied))
 }
 
 func (h defaultHandlers) AddDemoData(c *gin.Context) {
-	span, _ := opentracing.StartSpanFromContextWithTracer(c, h.tracer,
-		"defaultHandlers.AddDemoData")
-	defer span.Finish()
-	h.logger.Info("defaultHandlers.AddDemoData", zap.Field{Key: "method", String: c.Request.Method, Type: zapcore.StringType})
-	span.SetTag("method", c.Request.Method)
-	span.SetTag("params", c.Params)
-
-	if err := pgdb.AddDemoData(c, h.pool); err != nil {
-		h.logger.Error(fmt.Sprintf(`cannot add demo data: %s`, err))
-		span.LogFields(log.Error(err))
-		c.String(http.StatusInternalServerError, "Demo data is not added")
+	if err := pgdb.AddDemoData(c, h.pool, h.demo.AdminPassword); err != nil {
+		_ = c.Error(err)
+		return
 	}
 	c.String(http.StatusOK, "Demo data is added")
 }
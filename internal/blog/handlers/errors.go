@@ -0,0 +1,73 @@
+package blog
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+)
+
+// RequestIDHeader carries the id of a request, it is echoed in error responses.
+const RequestIDHeader = "X-Request-ID"
+
+var errAuthRequired = apperr.Unauthenticated("unauthenticated", "authentication required")
+
+// errorResponse is the body of every error response.
+type errorResponse struct {
+	Code      string                 `json:"code"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+}
+
+// Errors is a middleware which renders the last error added with c.Error as errorResponse.
+// The status code follows the error kind, internal errors are hidden from clients.
+// Errors themselves are logged by AccessLog.
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+		e := apperr.From(err)
+		resp := errorResponse{
+			Code:      e.Code,
+			Message:   e.Message,
+			Details:   e.Details,
+			RequestID: requestID(c),
+		}
+		if e.Kind == apperr.KindInternal {
+			resp.Message = "internal error"
+			resp.Details = nil
+		}
+		c.AbortWithStatusJSON(apperr.Status(e.Kind), resp)
+	}
+}
+
+func requestID(c *gin.Context) string {
+	if id := c.Writer.Header().Get(RequestIDHeader); id != "" {
+		return id
+	}
+	return c.GetHeader(RequestIDHeader)
+}
+
+// badJSON tells malformed bodies (400) from bodies failing the binding rules (422).
+func badJSON(err error) error {
+	var verr validator.ValidationErrors
+	if errors.As(err, &verr) {
+		fields := make([]string, 0, len(verr))
+		for _, fe := range verr {
+			fields = append(fields, fe.Field())
+		}
+		return apperr.Wrap(err, apperr.KindValidation, "invalid_body", "request body is invalid").
+			WithDetails("fields", fields)
+	}
+	return apperr.Wrap(err, apperr.KindBadRequest, "bad_json", "bad json")
+}
+
+func badParam(name string, err error) error {
+	return apperr.Wrap(err, apperr.KindBadRequest, "bad_param", fmt.Sprintf("bad %s", name)).
+		WithDetails("param", name)
+}
@@ -0,0 +1,37 @@
+package blog
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/ptsypyshev/simple-blog/internal/health"
+	"net/http"
+	"time"
+)
+
+type healthHandlers struct {
+	checks  []health.Check
+	timeout time.Duration
+}
+
+func NewHealthHandlers(checks []health.Check, timeout time.Duration) healthHandlers {
+	return healthHandlers{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+// Healthz serves GET /healthz, it answers as long as the process serves requests.
+func (h healthHandlers) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// Readyz serves GET /readyz with results and timings of dependency checks.
+// It answers 503 if a required check fails.
+func (h healthHandlers) Readyz(c *gin.Context) {
+	report := health.Run(c.Request.Context(), h.checks, h.timeout)
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, report)
+}
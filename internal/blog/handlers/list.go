@@ -0,0 +1,90 @@
+package blog
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"strconv"
+	"strings"
+)
+
+// listFilters are query params passed to stores as filters
+var listFilters = []string{"user_id", "post_id", "tag_id", "category_id", "comment_id", "moderator_id"}
+
+type listResponse struct {
+	Items interface{}  `json:"items"`
+	Page  *models.Page `json:"page"`
+}
+
+// bindList reads list params from the query:
+// ?limit=20&offset=40 or ?limit=20&cursor=..., ?sort=-title (descending), ?user_id=1&post_id=2&tag_id=3&category_id=4,
+// ?comment_id=5&moderator_id=6 for the moderation log.
+// Sort fields and filters are checked by the stores.
+func bindList(c *gin.Context) (models.ListParams, error) {
+	var (
+		params models.ListParams
+		err    error
+	)
+	if v := c.Query("limit"); v != "" {
+		if params.Limit, err = strconv.Atoi(v); err != nil || params.Limit < 0 {
+			return params, badParam("limit", err)
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if params.Offset, err = strconv.Atoi(v); err != nil || params.Offset < 0 {
+			return params, badParam("offset", err)
+		}
+	}
+	params.Cursor = c.Query("cursor")
+	params.Sort = strings.TrimPrefix(c.Query("sort"), "-")
+	params.Desc = strings.HasPrefix(c.Query("sort"), "-")
+	for _, name := range listFilters {
+		v, ok := c.GetQuery(name)
+		if !ok {
+			continue
+		}
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return params, badParam(name, err)
+		}
+		if params.Filters == nil {
+			params.Filters = make(map[string]int)
+		}
+		params.Filters[name] = id
+	}
+	return params, nil
+}
+
+// setLinks adds a Link header (RFC 8288) with the first and the next page,
+// and the previous one for offset pagination. Pages without a next cursor
+// are paginated by offset.
+func setLinks(c *gin.Context, params models.ListParams, page *models.Page) {
+	link := func(rel string, set map[string]string) string {
+		q := c.Request.URL.Query()
+		for k, v := range set {
+			if v == "" {
+				q.Del(k)
+				continue
+			}
+			q.Set(k, v)
+		}
+		q.Set("limit", strconv.Itoa(page.Limit))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, c.Request.URL.Path, q.Encode(), rel)
+	}
+	links := []string{link("first", map[string]string{"offset": "", "cursor": ""})}
+	if params.Cursor == "" && page.Offset > 0 {
+		prev := page.Offset - page.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link("prev", map[string]string{"offset": strconv.Itoa(prev)}))
+	}
+	if page.HasMore {
+		if page.NextCursor == "" || params.Cursor == "" && params.Offset > 0 {
+			links = append(links, link("next", map[string]string{"offset": strconv.Itoa(page.Offset + page.Limit)}))
+		} else {
+			links = append(links, link("next", map[string]string{"offset": "", "cursor": page.NextCursor}))
+		}
+	}
+	c.Header("Link", strings.Join(links, ", "))
+}
@@ -0,0 +1,103 @@
+package blog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// requestIDRe matches request ids accepted from clients and proxies
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID is a middleware which gives every request an id. An id sent in X-Request-ID
+// is kept if it looks sane, otherwise a random one is made. The id is echoed in the
+// response header and put into the request context for logs and the span.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDRe.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		ctx := logctx.WithRequestID(c.Request.Context(), id)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("http.request_id", id))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// AccessLog is a middleware which logs every request once it is served, with ids
+// of the request, the user and the trace. Errors of the request are logged with it,
+// server errors at error level and client errors at warn level.
+func AccessLog(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		status := c.Writer.Status()
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", c.FullPath()),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.Int("bytes", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.Strings("errors", c.Errors.Errors()))
+		}
+		// The user is known only after Authenticate, so fields are taken when the request is done
+		l := logctx.Logger(c.Request.Context(), logger)
+		switch {
+		case status >= http.StatusInternalServerError:
+			l.Error("request", fields...)
+		case status >= http.StatusBadRequest:
+			l.Warn("request", fields...)
+		default:
+			l.Info("request", fields...)
+		}
+	}
+}
+
+// Recovery is a middleware which turns a panic of a handler into an internal error response.
+// The panic goes to the log with its stack and to the span of the request.
+func Recovery(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			err := fmt.Errorf("panic: %v", r)
+			logctx.Logger(c.Request.Context(), logger).Error("panic recovered",
+				zap.Error(err),
+				zap.Stack("stack"),
+			)
+			trace.SpanFromContext(c.Request.Context()).RecordError(err)
+			_ = c.Error(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse{
+				Code:      string(apperr.KindInternal),
+				Message:   "internal error",
+				RequestID: requestID(c),
+			})
+		}()
+		c.Next()
+	}
+}
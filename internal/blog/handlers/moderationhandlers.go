@@ -0,0 +1,62 @@
+package blog
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// moderationRequest is a decision of a moderator about several comments
+type moderationRequest struct {
+	Ids    []int  `json:"ids"`
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// ListModerationQueue serves GET /moderation/comments?status=pending,
+// the oldest comments go first.
+func (h commentHandlers) ListModerationQueue(c *gin.Context) {
+	params, err := bindList(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	comments, page, err := h.commentrepo.Queue(c, c.Query("status"), params)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setLinks(c, params, page)
+	c.JSON(http.StatusOK, listResponse{Items: comments, Page: page})
+}
+
+// ModerateComments serves POST /moderation/comments with
+// {"ids": [1, 2], "status": "approved|rejected|spam|pending", "reason": "..."}.
+func (h commentHandlers) ModerateComments(c *gin.Context) {
+	var req moderationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(badJSON(err))
+		return
+	}
+	comments, err := h.commentrepo.Moderate(c, req.Ids, req.Status, req.Reason)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": comments})
+}
+
+// ListModerationLog serves GET /moderation/log?comment_id=1&moderator_id=2.
+func (h commentHandlers) ListModerationLog(c *gin.Context) {
+	params, err := bindList(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	entries, page, err := h.commentrepo.ModerationLog(c, params)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setLinks(c, params, page)
+	c.JSON(http.StatusOK, listResponse{Items: entries, Page: page})
+}
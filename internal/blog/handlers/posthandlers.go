@@ -3,148 +3,230 @@ package blog
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/log"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/auth"
 	"github.com/ptsypyshev/simple-blog/internal/models"
-	"github.com/ptsypyshev/simple-blog/internal/repositories/postrepo"
-	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
+	"github.com/ptsypyshev/simple-blog/internal/policy"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 )
 
 type postHandlers struct {
-	postrepo postrepo.Posts
-	logger   *zap.Logger
-	tracer   opentracing.Tracer
+	postrepo policy.Posts
 }
 
-func NewPostHandlers(ps postrepo.Posts, l *zap.Logger, t opentracing.Tracer) postHandlers {
+func NewPostHandlers(ps policy.Posts) postHandlers {
 	return postHandlers{
 		postrepo: ps,
-		logger:   l,
-		tracer:   t,
 	}
 }
 
 func (h postHandlers) CreatePost(c *gin.Context) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(c, h.tracer,
-		"postHandlers.CreatePost")
-	defer span.Finish()
-	h.logger.Info("postHandlers.CreatePost", zap.Field{Key: "method", String: c.Request.Method, Type: zapcore.StringType})
-	span.SetTag("method", c.Request.Method)
-	span.SetTag("params", c.Params)
 	var post models.Post
-	if err := c.BindJSON(&post); err != nil {
-		h.logger.Error(fmt.Sprintf(`bad json: %s`, err))
-		span.LogFields(
-			log.Error(err),
-		)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+	if err := c.ShouldBindJSON(&post); err != nil {
+		_ = c.Error(badJSON(err))
 		return
 	}
-	span.LogFields(
-		log.String("Post request", post.String()),
-	)
-	newPost, err := h.postrepo.Create(ctx, post)
+	// The author is the authenticated user, user_id from the body is ignored
+	userID, ok := auth.UserID(c)
+	if !ok {
+		_ = c.Error(errAuthRequired)
+		return
+	}
+	post.UserId = userID
+	newPost, err := h.postrepo.Create(c, post)
 	if err != nil {
-		msg := fmt.Sprintf(`create post error: %s`, err)
-		h.logger.Error(msg)
-		span.LogFields(log.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		_ = c.Error(err)
 		return
 	}
-	span.LogFields(
-		log.String("Post result", newPost.String()),
-	)
 	c.JSON(http.StatusOK, newPost)
 }
 
 func (h postHandlers) GetPost(c *gin.Context) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(c, h.tracer,
-		"postHandlers.GetPost")
-	defer span.Finish()
-	h.logger.Info("postHandlers.GetPost", zap.Field{Key: "method", String: c.Request.Method, Type: zapcore.StringType})
-	span.SetTag("method", c.Request.Method)
-	span.SetTag("params", c.Params)
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		h.logger.Warn(fmt.Sprintf(`bad param: %s`, err))
-		span.LogFields(log.Error(err))
-		c.String(http.StatusBadRequest, fmt.Sprintf(`bad id: %s`, c.Param("id")))
+		_ = c.Error(badParam("id", err))
+		return
+	}
+	include, err := bindPostInclude(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if include != nil {
+		post, err := h.postrepo.ReadExpanded(c, id, *include)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, post)
 		return
 	}
-	post, err := h.postrepo.Read(ctx, id)
+	post, err := h.postrepo.Read(c, id)
 	if err != nil {
-		msg := fmt.Sprintf(`get error: %s`, err)
-		h.logger.Warn(msg)
-		span.LogFields(log.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, post)
+}
+
+// GetPostBySlug serves GET /posts/by-slug/:slug, old slugs of a post are redirected
+// to the current one with 301 Moved Permanently.
+func (h postHandlers) GetPostBySlug(c *gin.Context) {
+	include, err := bindPostInclude(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	post, err := h.postrepo.ReadBySlug(c, c.Param("slug"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if post.Slug != c.Param("slug") {
+		location := "/posts/by-slug/" + url.PathEscape(post.Slug)
+		if c.Request.URL.RawQuery != "" {
+			location += "?" + c.Request.URL.RawQuery
+		}
+		c.Redirect(http.StatusMovedPermanently, location)
+		return
+	}
+	if include != nil {
+		expanded, err := h.postrepo.ReadExpanded(c, post.Id, *include)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, expanded)
 		return
 	}
-	span.LogFields(
-		log.String("Successfully get post ", fmt.Sprintf("%v", post)),
-	)
 	c.JSON(http.StatusOK, post)
 }
 
 func (h postHandlers) UpdatePost(c *gin.Context) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(c, h.tracer,
-		"postHandlers.UpdatePost")
-	defer span.Finish()
-	h.logger.Info("postHandlers.UpdatePost", zap.Field{Key: "method", String: c.Request.Method, Type: zapcore.StringType})
-	span.SetTag("method", c.Request.Method)
-	span.SetTag("params", c.Params)
 	var post models.Post
-	if err := c.BindJSON(&post); err != nil {
-		h.logger.Error(fmt.Sprintf(`bad json: %s`, err))
-		span.LogFields(
-			log.Error(err),
-		)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+	fields, err := bindUpdate(c, &post)
+	if err != nil {
+		_ = c.Error(badJSON(err))
 		return
 	}
-	span.LogFields(
-		log.String("Post request", post.String()),
-	)
-	updatedPost, err := h.postrepo.Update(ctx, post)
+	updatedPost, err := h.postrepo.Update(c, post, fields...)
 	if err != nil {
-		msg := fmt.Sprintf(`update post error: %s`, err)
-		h.logger.Error(msg)
-		span.LogFields(log.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		_ = c.Error(err)
 		return
 	}
-	span.LogFields(
-		log.String("Post result", updatedPost.String()),
-	)
 	c.JSON(http.StatusOK, updatedPost)
 }
 
 func (h postHandlers) DeletePost(c *gin.Context) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(c, h.tracer,
-		"postHandlers.DeletePost")
-	defer span.Finish()
-	h.logger.Info("postHandlers.DeletePost", zap.Field{Key: "method", String: c.Request.Method, Type: zapcore.StringType})
-	span.SetTag("method", c.Request.Method)
-	span.SetTag("params", c.Params)
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		h.logger.Warn(fmt.Sprintf(`bad param: %s`, err))
-		span.LogFields(log.Error(err))
-		c.String(http.StatusBadRequest, fmt.Sprintf(`bad id: %s`, c.Param("id")))
+		_ = c.Error(badParam("id", err))
 		return
 	}
-	deletedPost, err := h.postrepo.Delete(ctx, id)
+	deletedPost, err := h.postrepo.Delete(c, id)
 	if err != nil {
-		msg := fmt.Sprintf(`delete post error: %s`, err)
-		h.logger.Error(msg)
-		span.LogFields(log.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		_ = c.Error(err)
 		return
 	}
-	span.LogFields(
-		log.String("Post result", deletedPost.String()),
-	)
 	c.JSON(http.StatusOK, deletedPost)
 }
+
+func (h postHandlers) ListPosts(c *gin.Context) {
+	params, err := bindList(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	posts, page, err := h.postrepo.List(c, params)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setLinks(c, params, page)
+	c.JSON(http.StatusOK, listResponse{Items: posts, Page: page})
+}
+
+// ListUserPosts serves GET /users/:id/posts.
+func (h postHandlers) ListUserPosts(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(badParam("id", err))
+		return
+	}
+	params, err := bindList(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	posts, page, err := h.postrepo.ListByUser(c, userID, params)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setLinks(c, params, page)
+	c.JSON(http.StatusOK, listResponse{Items: posts, Page: page})
+}
+
+// ListTagPosts serves GET /tags/:slug/posts.
+func (h postHandlers) ListTagPosts(c *gin.Context) {
+	params, err := bindList(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	posts, page, err := h.postrepo.ListByTag(c, c.Param("slug"), params)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setLinks(c, params, page)
+	c.JSON(http.StatusOK, listResponse{Items: posts, Page: page})
+}
+
+// ListCategoryPosts serves GET /categories/:slug/posts.
+func (h postHandlers) ListCategoryPosts(c *gin.Context) {
+	params, err := bindList(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	posts, page, err := h.postrepo.ListByCategory(c, c.Param("slug"), params)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setLinks(c, params, page)
+	c.JSON(http.StatusOK, listResponse{Items: posts, Page: page})
+}
+
+// bindPostInclude reads ?include=author,comments&comments_limit=5.
+// It returns nil if nothing is included.
+func bindPostInclude(c *gin.Context) (*models.PostInclude, error) {
+	v := c.Query("include")
+	if v == "" {
+		return nil, nil
+	}
+	var include models.PostInclude
+	for _, name := range strings.Split(v, ",") {
+		switch strings.TrimSpace(name) {
+		case "author":
+			include.Author = true
+		case "comments":
+			include.Comments = true
+		default:
+			return nil, apperr.BadRequest("unknown_include", fmt.Sprintf("cannot include %s", name)).
+				WithDetails("include", name)
+		}
+	}
+	if v := c.Query("comments_limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return nil, badParam("comments_limit", err)
+		}
+		include.CommentsLimit = limit
+	}
+	return &include, nil
+}
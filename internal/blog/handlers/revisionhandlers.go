@@ -0,0 +1,99 @@
+package blog
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// ListPostRevisions serves GET /posts/:id/revisions.
+func (h postHandlers) ListPostRevisions(c *gin.Context) {
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(badParam("id", err))
+		return
+	}
+	params, err := bindList(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	revisions, page, err := h.postrepo.ListRevisions(c, postID, params)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setLinks(c, params, page)
+	c.JSON(http.StatusOK, listResponse{Items: revisions, Page: page})
+}
+
+// GetPostRevision serves GET /posts/:id/revisions/:rev.
+func (h postHandlers) GetPostRevision(c *gin.Context) {
+	postID, rev, err := bindRevision(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	revision, err := h.postrepo.ReadRevision(c, postID, rev)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, revision)
+}
+
+// DiffPostRevisions serves GET /posts/:id/revisions/diff?from=1&to=2,
+// the default of from is the revision before to.
+func (h postHandlers) DiffPostRevisions(c *gin.Context) {
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(badParam("id", err))
+		return
+	}
+	to, err := strconv.Atoi(c.Query("to"))
+	if err != nil {
+		_ = c.Error(badParam("to", err))
+		return
+	}
+	from := to - 1
+	if v := c.Query("from"); v != "" {
+		if from, err = strconv.Atoi(v); err != nil {
+			_ = c.Error(badParam("from", err))
+			return
+		}
+	}
+	diff, err := h.postrepo.Diff(c, postID, from, to)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+// RestorePostRevision serves POST /posts/:id/revisions/:rev/restore.
+func (h postHandlers) RestorePostRevision(c *gin.Context) {
+	postID, rev, err := bindRevision(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	post, err := h.postrepo.Restore(c, postID, rev)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, post)
+}
+
+// bindRevision reads :id and :rev params
+func bindRevision(c *gin.Context) (int, int, error) {
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, 0, badParam("id", err)
+	}
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		return 0, 0, badParam("rev", err)
+	}
+	return postID, rev, nil
+}
@@ -0,0 +1,95 @@
+package blog
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/policy"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// searchDate is the layout of from/to params given as dates, RFC 3339 times are accepted too
+const searchDate = "2006-01-02"
+
+type searchHandlers struct {
+	searchrepo policy.Search
+}
+
+func NewSearchHandlers(s policy.Search) searchHandlers {
+	return searchHandlers{
+		searchrepo: s,
+	}
+}
+
+// Search serves GET /search?q=...&type=post&user_id=1&from=2022-01-01&to=2022-12-31&limit=20&offset=0.
+// The query uses the web search syntax: "quoted phrases", OR and -excluded words.
+func (h searchHandlers) Search(c *gin.Context) {
+	params, err := bindSearch(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	results, page, err := h.searchrepo.Search(c, params)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setLinks(c, params.ListParams, page)
+	c.JSON(http.StatusOK, listResponse{Items: results, Page: page})
+}
+
+func bindSearch(c *gin.Context) (models.SearchParams, error) {
+	var (
+		params models.SearchParams
+		err    error
+	)
+	params.Query = c.Query("q")
+	params.Type = c.Query("type")
+	if v := c.Query("limit"); v != "" {
+		if params.Limit, err = strconv.Atoi(v); err != nil || params.Limit < 0 {
+			return params, badParam("limit", err)
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if params.Offset, err = strconv.Atoi(v); err != nil || params.Offset < 0 {
+			return params, badParam("offset", err)
+		}
+	}
+	if v := c.Query("user_id"); v != "" {
+		if params.UserId, err = strconv.Atoi(v); err != nil {
+			return params, badParam("user_id", err)
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		from, err := parseSearchTime(v, false)
+		if err != nil {
+			return params, badParam("from", err)
+		}
+		params.From = &from
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := parseSearchTime(v, true)
+		if err != nil {
+			return params, badParam("to", err)
+		}
+		params.To = &to
+	}
+	return params, nil
+}
+
+// parseSearchTime parses an RFC 3339 time or a UTC date. A date as the end
+// of a period includes the whole day.
+func parseSearchTime(v string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(searchDate, v)
+	if err != nil {
+		return t, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,87 @@
+package blog
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/policy"
+	"net/http"
+	"strconv"
+)
+
+type tagHandlers struct {
+	tagrepo policy.Tags
+}
+
+func NewTagHandlers(r policy.Tags) tagHandlers {
+	return tagHandlers{
+		tagrepo: r,
+	}
+}
+
+func (h tagHandlers) CreateTag(c *gin.Context) {
+	var tag models.Tag
+	if err := c.ShouldBindJSON(&tag); err != nil {
+		_ = c.Error(badJSON(err))
+		return
+	}
+	newTag, err := h.tagrepo.Create(c, tag)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, newTag)
+}
+
+// GetTag serves GET /tags/:slug.
+func (h tagHandlers) GetTag(c *gin.Context) {
+	tag, err := h.tagrepo.ReadBySlug(c, c.Param("slug"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, tag)
+}
+
+func (h tagHandlers) UpdateTag(c *gin.Context) {
+	var tag models.Tag
+	fields, err := bindUpdate(c, &tag)
+	if err != nil {
+		_ = c.Error(badJSON(err))
+		return
+	}
+	updatedTag, err := h.tagrepo.Update(c, tag, fields...)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, updatedTag)
+}
+
+func (h tagHandlers) DeleteTag(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(badParam("id", err))
+		return
+	}
+	deletedTag, err := h.tagrepo.Delete(c, id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, deletedTag)
+}
+
+func (h tagHandlers) ListTags(c *gin.Context) {
+	params, err := bindList(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	tags, page, err := h.tagrepo.List(c, params)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setLinks(c, params, page)
+	c.JSON(http.StatusOK, listResponse{Items: tags, Page: page})
+}
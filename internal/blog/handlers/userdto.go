@@ -0,0 +1,68 @@
+package blog
+
+import (
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"time"
+)
+
+// userRequest is the body of user create/update requests, the only place where a password is accepted.
+type userRequest struct {
+	Id        int    `json:"id"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	IsActive  bool   `json:"is_active"`
+	Role      string `json:"role"`
+}
+
+func (r userRequest) User() models.User {
+	return models.User{
+		Id:        r.Id,
+		Username:  r.Username,
+		Password:  r.Password,
+		FirstName: r.FirstName,
+		LastName:  r.LastName,
+		Email:     r.Email,
+		IsActive:  r.IsActive,
+		Role:      r.Role,
+	}
+}
+
+// userResponse is a user as returned by the API, it never carries the password hash.
+type userResponse struct {
+	Id        int       `json:"id"`
+	Username  string    `json:"username"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	IsActive  bool      `json:"is_active"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy int       `json:"updated_by"`
+}
+
+func newUserResponse(u *models.User) userResponse {
+	return userResponse{
+		Id:        u.Id,
+		Username:  u.Username,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Email:     u.Email,
+		IsActive:  u.IsActive,
+		Role:      u.Role,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		UpdatedBy: u.UpdatedBy,
+	}
+}
+
+func newUserResponses(users []models.User) []userResponse {
+	res := make([]userResponse, 0, len(users))
+	for i := range users {
+		res = append(res, newUserResponse(&users[i]))
+	}
+	return res
+}
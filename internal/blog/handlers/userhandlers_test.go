@@ -0,0 +1,181 @@
+package blog
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/auth"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/policy"
+	"github.com/ptsypyshev/simple-blog/internal/redact"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/userrepo"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	// testHash is a bcrypt hash as stored in users.password
+	testHash = "$2a$08$KUQ3zH1Cg3z0p1Nn7bJ6ZuKx6bXy0sZy6H0m1l8cN2yQb6i4tJg2C"
+	// testPassword is a plain password sent by clients
+	testPassword = "plain-pass-42"
+)
+
+// fakeUsers is an in-memory userrepo.UserStorage, its users carry password hashes like rows of the DB.
+type fakeUsers struct {
+	users map[int]models.User
+	next  int
+}
+
+func newFakeUsers() *fakeUsers {
+	return &fakeUsers{
+		users: map[int]models.User{
+			1: {Id: 1, Username: "admin", Password: testHash, IsActive: true, Role: models.RoleAdmin},
+			2: {Id: 2, Username: "vpupkin", Password: testHash, IsActive: true, Role: models.RoleAuthor},
+		},
+		next: 3,
+	}
+}
+
+func (f *fakeUsers) Create(_ context.Context, user models.User) (int, error) {
+	user.Id = f.next
+	user.Password = testHash
+	f.users[user.Id] = user
+	f.next++
+	return user.Id, nil
+}
+
+func (f *fakeUsers) Read(_ context.Context, id int) (*models.User, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return nil, apperr.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (f *fakeUsers) Update(_ context.Context, user models.User, _ ...string) (*models.User, error) {
+	if _, ok := f.users[user.Id]; !ok {
+		return nil, apperr.ErrNotFound
+	}
+	user.Password = testHash
+	f.users[user.Id] = user
+	return &user, nil
+}
+
+func (f *fakeUsers) Delete(_ context.Context, id int) error {
+	delete(f.users, id)
+	return nil
+}
+
+func (f *fakeUsers) List(_ context.Context, _ models.ListParams) ([]models.User, *models.Page, error) {
+	users := make([]models.User, 0, len(f.users))
+	for id := 1; id < f.next; id++ {
+		if user, ok := f.users[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, &models.Page{}, nil
+}
+
+// TestUserEndpointsHidePasswords sends requests to every user endpoint and checks
+// that neither the password hash nor the plain password gets into responses, logs or spans.
+func TestUserEndpointsHidePasswords(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/users/", ""},
+		{http.MethodGet, "/users/2", ""},
+		{http.MethodPost, "/users/", fmt.Sprintf(`{"username":"iivanov","password":%q,"role":"author"}`, testPassword)},
+		{http.MethodPut, "/users/", fmt.Sprintf(`{"id":2,"username":"vpupkin","password":%q,"is_active":true,"role":"author"}`, testPassword)},
+		{http.MethodPatch, "/users/", fmt.Sprintf(`{"id":2,"password":%q}`, testPassword)},
+		{http.MethodDelete, "/users/2", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			obs, logs := observer.New(zapcore.DebugLevel)
+			logger := zap.New(redact.NewCore(obs))
+			spans := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(redact.NewExporter(spans)))
+			defer func() { _ = tp.Shutdown(context.Background()) }()
+
+			router := newUserRouter(newFakeUsers(), logger, tp)
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			body := w.Body.String()
+			for _, s := range []string{testHash, testPassword, `"password"`, "token"} {
+				if strings.Contains(body, s) {
+					t.Errorf("response carries %q: %s", s, body)
+				}
+			}
+			if logs.Len() == 0 {
+				t.Error("nothing is logged, want the access log")
+			}
+			for _, e := range logs.AllUntimed() {
+				line := e.Message + " " + fmt.Sprint(e.ContextMap())
+				if strings.Contains(line, testHash) || strings.Contains(line, testPassword) {
+					t.Errorf("log carries a credential: %s", line)
+				}
+			}
+			if len(spans.GetSpans()) == 0 {
+				t.Error("no spans are exported")
+			}
+			for _, s := range spans.GetSpans() {
+				attrs := append([]attribute.KeyValue{}, s.Attributes...)
+				for _, e := range s.Events {
+					attrs = append(attrs, e.Attributes...)
+				}
+				for _, kv := range attrs {
+					v := kv.Value.Emit()
+					if strings.Contains(v, testHash) || strings.Contains(v, testPassword) {
+						t.Errorf("span %s carries a credential in %s", s.Name, kv.Key)
+					}
+				}
+			}
+		})
+	}
+}
+
+// newUserRouter serves the user routes as the app does, with the admin logged in.
+func newUserRouter(store userrepo.UserStorage, logger *zap.Logger, tp *sdktrace.TracerProvider) *gin.Engine {
+	users := userrepo.NewUsers(store, logger)
+	handlers := NewUserHandlers(*policy.NewUsers(*users, policy.New(users)))
+	admin := &models.User{Id: 1, Username: "admin", Password: testHash, IsActive: true, Role: models.RoleAdmin}
+
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(
+		otelgin.Middleware("test", otelgin.WithTracerProvider(tp)),
+		RequestID(),
+		AccessLog(logger),
+		Recovery(logger),
+		Errors(),
+		func(c *gin.Context) {
+			c.Request = c.Request.WithContext(auth.WithUser(c.Request.Context(), admin))
+		},
+	)
+	router.GET("/users/", handlers.ListUsers)
+	router.GET("/users/:id", handlers.GetUser)
+	router.POST("/users/", handlers.CreateUser)
+	router.PUT("/users/", handlers.UpdateUser)
+	router.PATCH("/users/", handlers.UpdateUser)
+	router.DELETE("/users/:id", handlers.DeleteUser)
+	return router
+}
@@ -3,60 +3,25 @@ package blog
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/opentracing/opentracing-go"
-	"github.com/uber/jaeger-client-go/config"
+	"github.com/ptsypyshev/simple-blog/internal/config"
+	"github.com/ptsypyshev/simple-blog/internal/redact"
 	"go.uber.org/zap"
-	"io"
 	"log"
 	"reflect"
 )
 
-type zapWrapper struct {
-	logger *zap.Logger
-}
-
-// Error logs a message at error priority
-func (w *zapWrapper) Error(msg string) {
-	w.logger.Error(msg)
-}
-
-// Infof logs a message at info priority
-func (w *zapWrapper) Infof(msg string, args ...interface{}) {
-	w.logger.Sugar().Infof(msg, args...)
-}
-
-// InitJaeger Для инициализации через передаваемые параметры
-//func InitJaeger(service string, jaegerServerHostPort string, logger *zap.Logger) (opentracing.Tracer, io.Closer) {
-//	cfg := &config.Configuration{
-//		ServiceName: service,
-//		Sampler: &config.SamplerConfig{
-//			Type:  "const",
-//			Param: 1,
-//		},
-//		Reporter: &config.ReporterConfig{
-//			LogSpans:           true,
-//			LocalAgentHostPort: jaegerServerHostPort,
-//		},
-//	}
-//
-//	tracer, closer, err := cfg.NewTracer(config.Logger(&zapWrapper{logger: logger}))
-//	if err != nil {
-//		panic(fmt.Sprintf("ERROR: cannot init Jaeger: %v\n", err))
-//	}
-//	return tracer, closer
-//}
-
-// InitJaeger Для инициализации через переменные окружения
-func InitJaeger(logger *zap.Logger) (opentracing.Tracer, io.Closer) {
-	cfg, err := config.FromEnv()
-	if err != nil {
-		logger.Warn("cannot parse Jaeger env vars", zap.Error(err))
+// NewLogger creates a zap logger with the configured level and format (console or json)
+func NewLogger(cfg config.Log) (*zap.Logger, error) {
+	var zcfg zap.Config
+	if cfg.Format == "json" {
+		zcfg = zap.NewProductionConfig()
+	} else {
+		zcfg = zap.NewDevelopmentConfig()
 	}
-	tracer, closer, err := cfg.NewTracer(config.Logger(&zapWrapper{logger: logger}))
-	if err != nil {
-		panic(fmt.Sprintf("ERROR: cannot init Jaeger: %v\n", err))
+	if err := zcfg.Level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, err
 	}
-	return tracer, closer
+	return zcfg.Build(zap.WrapCore(redact.NewCore))
 }
 
 var LogFunc = log.Println
@@ -0,0 +1,126 @@
+package blog
+
+import (
+	"context"
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/config"
+	"github.com/ptsypyshev/simple-blog/internal/redact"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// ShutdownTimeout limits flushing of spans left on shutdown
+const ShutdownTimeout = 5 * time.Second
+
+// tracingCloser flushes spans and stops the exporter
+type tracingCloser struct {
+	tp *sdktrace.TracerProvider
+}
+
+func (c tracingCloser) Close() error {
+	if c.tp == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	return c.tp.Shutdown(ctx)
+}
+
+// InitTracing sets the global OpenTelemetry tracer provider and the W3C trace context
+// propagator. Spans of disabled tracing are dropped, but trace context is still passed on.
+func InitTracing(cfg config.Tracing, logger *zap.Logger) (io.Closer, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn(fmt.Sprintf(`tracing error: %s`, err))
+	}))
+	if !cfg.Enabled {
+		return tracingCloser{}, nil
+	}
+
+	exporter, err := newExporter(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot init trace exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("cannot init trace resource: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(redact.NewExporter(exporter)),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	logger.Info("tracing is enabled", zap.String("exporter", cfg.Exporter))
+	return tracingCloser{tp: tp}, nil
+}
+
+func newExporter(cfg config.Tracing) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(context.Background(), opts...)
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "file":
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return fileExporter{SpanExporter: exporter, f: f}, nil
+	}
+	return nil, fmt.Errorf("unknown exporter %q", cfg.Exporter)
+}
+
+// fileExporter closes the file of spans on shutdown
+type fileExporter struct {
+	sdktrace.SpanExporter
+	f *os.File
+}
+
+func (e fileExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if cerr := e.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// TracingCheck reports whether the OTLP collector accepts connections.
+// Other exporters write locally, so there is nothing to reach.
+func TracingCheck(cfg config.Tracing) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if !cfg.Enabled || cfg.Exporter != "otlp" {
+			return nil
+		}
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", cfg.Endpoint)
+		if err != nil {
+			return fmt.Errorf("collector is unreachable: %w", err)
+		}
+		return conn.Close()
+	}
+}
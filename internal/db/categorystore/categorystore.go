@@ -0,0 +1,183 @@
+package categorystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/categoryrepo"
+	"go.uber.org/zap"
+)
+
+const (
+	// CategoryPostCount counts public posts of a category and its subcategories
+	CategoryPostCount = `(
+    WITH RECURSIVE sub AS (
+        SELECT categories.id
+        UNION ALL
+        SELECT c.id FROM categories c JOIN sub ON c.parent_id = sub.id
+    )
+    SELECT count(*) FROM posts p JOIN sub ON p.category_id = sub.id
+    WHERE p.status IN ('published', 'archived'))`
+	CategoryColumns = `id, name, slug, COALESCE(parent_id, 0), ` + CategoryPostCount + `,
+    created_at, updated_at, COALESCE(updated_by, 0)`
+	CategoryCreate = `
+INSERT INTO categories(name, slug, parent_id, updated_by)
+VALUES
+    ($1, $2, NULLIF($3, 0), $4)
+RETURNING id;
+`
+	CategorySelectByID   = `SELECT ` + CategoryColumns + ` FROM categories WHERE id = $1;`
+	CategorySelectBySlug = `SELECT ` + CategoryColumns + ` FROM categories WHERE slug = $1;`
+	CategorySelectAll    = `SELECT ` + CategoryColumns + ` FROM categories ORDER BY name, id;`
+	CategoryDeleteByID   = `
+DELETE FROM categories WHERE id = $1;
+`
+	// CategoryIsDescendant walks up from $1 looking for $2
+	CategoryIsDescendant = `
+WITH RECURSIVE up AS (
+    SELECT id, parent_id FROM categories WHERE id = $1
+    UNION ALL
+    SELECT c.id, c.parent_id FROM categories c JOIN up ON c.id = up.parent_id
+)
+SELECT EXISTS(SELECT 1 FROM up WHERE id = $2);
+`
+)
+
+var _ categoryrepo.CategoryStorage = &CategoriesDB{}
+
+type CategoriesDB struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+func NewCategoriesDB(p *pgxpool.Pool, l *zap.Logger) *CategoriesDB {
+	return &CategoriesDB{
+		pool:   p,
+		logger: l,
+	}
+}
+
+func (db *CategoriesDB) Create(ctx context.Context, category models.Category) (int, error) {
+	var id int
+	res := db.pool.QueryRow(
+		ctx, CategoryCreate, category.Name, category.Slug, category.ParentId, pgdb.ActorID(ctx),
+	)
+	err := res.Scan(&id)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return 0, err
+	}
+	return id, nil
+}
+
+func (db *CategoriesDB) Read(ctx context.Context, id int) (*models.Category, error) {
+	var category models.Category
+	err := scanCategory(db.pool.QueryRow(ctx, CategorySelectByID, id), &category)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: category id %d", pgdb.ErrNotFound, id)
+	}
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (db *CategoriesDB) ReadBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	var category models.Category
+	err := scanCategory(db.pool.QueryRow(ctx, CategorySelectBySlug, slug), &category)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: category %s", pgdb.ErrNotFound, slug)
+	}
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (db *CategoriesDB) Update(ctx context.Context, category models.Category, fields ...string) (*models.Category, error) {
+	upd, err := pgdb.UpdateFromStruct("categories", category, fields)
+	if err != nil {
+		err = fmt.Errorf("cannot compile query: %w", err)
+		err = pgdb.TranslateError(err)
+		return &models.Category{}, err
+	}
+	// Zero parent makes a root category
+	upd.Wrap("parent_id", "NULLIF(%s, 0)")
+	upd.Stamp(ctx)
+	UpdateQuery, args, err := upd.Query()
+	if err != nil {
+		err = fmt.Errorf("cannot compile query: %w", err)
+		err = pgdb.TranslateError(err)
+		return &models.Category{}, err
+	}
+	res, err := db.pool.Exec(ctx, UpdateQuery, args...)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return &models.Category{}, err
+	}
+
+	if res.RowsAffected() == 0 {
+		err = fmt.Errorf("%w: category id %d", pgdb.ErrNotFound, category.Id)
+		return &models.Category{}, err
+	}
+	// Only a part of fields may be updated, so return the actual row
+	return db.Read(ctx, category.Id)
+}
+
+func (db *CategoriesDB) Delete(ctx context.Context, id int) error {
+	res, err := db.pool.Exec(ctx, CategoryDeleteByID, id)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		err = fmt.Errorf("%w: category id %d", pgdb.ErrNotFound, id)
+		return err
+	}
+	return nil
+}
+
+// All returns all categories sorted by name, the tree is small enough to be read at once.
+func (db *CategoriesDB) All(ctx context.Context) ([]models.Category, error) {
+	rows, err := db.pool.Query(ctx, CategorySelectAll)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	defer rows.Close()
+	var categories []models.Category
+	for rows.Next() {
+		var category models.Category
+		if err := scanCategory(rows, &category); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return categories, nil
+}
+
+// IsDescendant reports whether category id is ancestor or a subcategory of it.
+func (db *CategoriesDB) IsDescendant(ctx context.Context, id, ancestor int) (bool, error) {
+	var found bool
+	if err := db.pool.QueryRow(ctx, CategoryIsDescendant, id, ancestor).Scan(&found); err != nil {
+		err = pgdb.TranslateError(err)
+		return false, err
+	}
+	return found, nil
+}
+
+func scanCategory(row pgx.Row, category *models.Category) error {
+	return row.Scan(&category.Id, &category.Name, &category.Slug, &category.ParentId, &category.PostCount,
+		&category.CreatedAt, &category.UpdatedAt, &category.UpdatedBy)
+}
@@ -2,77 +2,109 @@ package commentstore
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
-	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/log"
 	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
 	"github.com/ptsypyshev/simple-blog/internal/models"
 	"github.com/ptsypyshev/simple-blog/internal/repositories/commentrepo"
 	"go.uber.org/zap"
-	"strconv"
 )
 
 const (
+	CommentColumns = `id, body, body_html, COALESCE(user_id, 0), COALESCE(post_id, 0), COALESCE(parent_id, 0), depth, deleted_at, status,
+    created_at, updated_at, COALESCE(updated_by, 0)`
 	CommentCreate = `
-INSERT INTO comments(body, user_id, post_id)
+INSERT INTO comments(body, body_html, user_id, post_id, parent_id, depth, status, spam_score, spam_reasons, updated_by)
 VALUES
-    ($1, $2, $3)
+    ($1, $2, $3, $4, NULLIF($5, 0), $6, $7, $8, $9, $10)
 RETURNING id;
 `
-	CommentSelectByID = `SELECT * FROM comments WHERE id = $1;`
-	CommentDeleteByID = `
-DELETE FROM comments WHERE id = $1;
+	CommentSelectByID = `SELECT ` + CommentColumns + ` FROM comments WHERE id = $1;`
+	CommentPostExists = `SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1);`
+	// CommentSelectThread is completed with the scope of the viewer
+	CommentSelectThread = `SELECT ` + CommentColumns + ` FROM comments WHERE post_id = $1%s ORDER BY id;`
+	CommentHasReplies   = `SELECT EXISTS(SELECT 1 FROM comments WHERE parent_id = $1);`
+	// CommentLock locks a comment before its replies are checked. Inserts of replies take
+	// FOR KEY SHARE on the parent to check the foreign key, so they wait for the lock.
+	CommentLock = `SELECT id FROM comments WHERE id = $1 FOR UPDATE;`
+	// CommentTombstone keeps a deleted comment with replies in its thread
+	CommentTombstone = `
+UPDATE comments SET body = '[deleted]', body_html = '<p>[deleted]</p>', user_id = NULL,
+    deleted_at = NOW(), updated_at = NOW(), updated_by = $2
+WHERE id = $1;
 `
+	// CommentPrune deletes a tombstone without replies left and returns its parent
+	CommentPrune = `
+DELETE FROM comments WHERE id = $1 AND deleted_at IS NOT NULL
+    AND NOT EXISTS(SELECT 1 FROM comments r WHERE r.parent_id = $1)
+RETURNING COALESCE(parent_id, 0);
+`
+	CommentDeleteReturning = `DELETE FROM comments WHERE id = $1 RETURNING COALESCE(parent_id, 0);`
 )
 
 var _ commentrepo.CommentStorage = &CommentsDB{}
 
+var commentList = pgdb.List{
+	Table:   "comments",
+	Columns: CommentColumns,
+	Sorts: map[string]pgdb.SortField{
+		"id":         {Column: "id", Type: "int"},
+		"created_at": {Column: "created_at", Type: "timestamptz"},
+	},
+	DefaultSort: "id",
+	Filters: map[string]string{
+		"user_id": "user_id",
+		"post_id": "post_id",
+	},
+	Scope: commentScope,
+}
+
+// visiblePosts selects posts everyone may see, like the post lists do
+const visiblePosts = `SELECT p.id FROM posts p WHERE p.status IN ('published', 'archived')`
+
+// commentScope shows approved comments of visible posts only. Viewers see their own comments
+// waiting for moderation and comments of their own posts as well, moderators see all of them.
+func commentScope(p models.ListParams, arg func(interface{}) string) string {
+	switch {
+	case p.ViewAll:
+		return ""
+	case p.ViewerId != 0:
+		viewer := arg(p.ViewerId)
+		return fmt.Sprintf("(status = 'approved' OR user_id = %[1]s) AND post_id IN (%[2]s OR p.user_id = %[1]s)",
+			viewer, visiblePosts)
+	}
+	return "status = 'approved' AND post_id IN (" + visiblePosts + ")"
+}
+
 type CommentsDB struct {
 	pool   *pgxpool.Pool
 	logger *zap.Logger
-	tracer opentracing.Tracer
 }
 
-func NewCommentsDB(p *pgxpool.Pool, l *zap.Logger, t opentracing.Tracer) *CommentsDB {
+func NewCommentsDB(p *pgxpool.Pool, l *zap.Logger) *CommentsDB {
 	return &CommentsDB{
 		pool:   p,
 		logger: l,
-		tracer: t,
 	}
 }
 
-func (db *CommentsDB) Create(ctx context.Context, comment models.Comment) (int, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, db.tracer,
-		"CommentStore.Create")
-	defer span.Finish()
-	span.LogFields(
-		log.String("query", CommentCreate),
-		log.String("arg0", comment.String()),
-	)
+// Create stores a comment with the result of its spam check.
+func (db *CommentsDB) Create(ctx context.Context, comment models.Comment, spam models.SpamCheck) (int, error) {
 	var id int
 	res := db.pool.QueryRow(
-		ctx, CommentCreate, comment.Body, comment.UserId, comment.PostId,
+		ctx, CommentCreate, comment.Body, comment.BodyHTML, comment.UserId, comment.PostId, comment.ParentId, comment.Depth, comment.Status, spam.Score, spam.Reasons, pgdb.ActorID(ctx),
 	)
 	err := res.Scan(&id)
 	if err != nil {
-		span.LogFields(log.Error(err))
+		err = pgdb.TranslateError(err)
 		return 0, err
 	}
-	span.LogFields(
-		log.String("Comment result", comment.String()),
-	)
 	return id, nil
 }
 
 func (db *CommentsDB) Read(ctx context.Context, id int) (*models.Comment, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, db.tracer,
-		"CommentStore.Read")
-	defer span.Finish()
-	span.LogFields(
-		log.String("query", CommentSelectByID),
-		log.String("arg0", strconv.Itoa(id)),
-	)
 	rows, _ := db.pool.Query(ctx, CommentSelectByID, id)
 	var (
 		comment models.Comment
@@ -81,81 +113,229 @@ func (db *CommentsDB) Read(ctx context.Context, id int) (*models.Comment, error)
 	for rows.Next() {
 		if found {
 			err := fmt.Errorf("%w: comment id %d", pgdb.ErrMultipleFound, id)
-			span.LogFields(log.Error(err))
 			return nil, err
 		}
-		if err := rows.Scan(&comment.Id, &comment.Date, &comment.Body, &comment.UserId, &comment.PostId); err != nil {
-			span.LogFields(log.Error(err))
+		if err := rows.Scan(commentFields(&comment)...); err != nil {
+			err = pgdb.TranslateError(err)
 			return nil, err
 		}
 		found = true
 	}
 	if err := rows.Err(); err != nil {
-		span.LogFields(log.Error(err))
+		err = pgdb.TranslateError(err)
 		return nil, err
 	}
 	if !found {
 		err := fmt.Errorf("%w: comment id %d", pgdb.ErrNotFound, id)
-		span.LogFields(log.Error(err))
 		return nil, err
 	}
-	span.LogFields(
-		log.String("Comment result", comment.String()),
-	)
 	return &comment, nil
 }
 
-func (db *CommentsDB) Update(ctx context.Context, comment models.Comment) (*models.Comment, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, db.tracer,
-		"CommentStore.Update")
-	defer span.Finish()
-	UpdateQuery, err := pgdb.UpdateQueryCompilation("comments", comment, models.Comment{})
+// Update writes fields of a comment. The status and the spam check are not fields
+// clients write, they are written along when the repo sets them. A status change is
+// kept in the moderation log with the reason EditReason.
+func (db *CommentsDB) Update(ctx context.Context, comment models.Comment, spam *models.SpamCheck, fields ...string) (*models.Comment, error) {
+	upd, err := pgdb.UpdateFromStruct("comments", comment, fields)
 	if err != nil {
 		err = fmt.Errorf("cannot compile query: %w", err)
-		span.LogFields(log.Error(err))
+		err = pgdb.TranslateError(err)
 		return &models.Comment{}, err
 	}
-	span.LogFields(
-		log.String("query", UpdateQuery),
-		log.String("arg0", comment.String()),
-	)
-	res, err := db.pool.Exec(ctx, UpdateQuery)
+	statusSet := upd.Len() > 0 && comment.Status != ""
+	if upd.Len() > 0 && spam != nil {
+		upd.Set("spam_score", spam.Score)
+		upd.Set("spam_reasons", spam.Reasons)
+	}
+	upd.Stamp(ctx)
+	UpdateQuery, args, err := upd.Query()
 	if err != nil {
-		span.LogFields(log.Error(err))
+		err = fmt.Errorf("cannot compile query: %w", err)
+		err = pgdb.TranslateError(err)
 		return &models.Comment{}, err
 	}
-
-	if rowsAffected := res.RowsAffected(); rowsAffected != 1 {
-		err = fmt.Errorf("update comment error: %d rows affected", rowsAffected)
-		span.LogFields(log.Error(err))
+	err = db.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, UpdateQuery, args...)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return fmt.Errorf("%w: comment id %d", pgdb.ErrNotFound, comment.Id)
+		}
+		if !statusSet {
+			return nil
+		}
+		// The status is changed as by moderators, so the change is logged with the editor
+		_, err = tx.Exec(ctx, CommentModerate, []int{comment.Id}, comment.Status, EditReason, pgdb.ActorID(ctx))
+		return err
+	})
+	if err != nil {
+		err = pgdb.TranslateError(err)
 		return &models.Comment{}, err
 	}
-	span.LogFields(
-		log.String("Comment result", comment.String()),
-	)
-	return &comment, nil
+	// Only a part of fields may be updated, so return the actual row
+	return db.Read(ctx, comment.Id)
 }
 
+// Delete removes a comment. A comment with replies becomes a tombstone instead,
+// and tombstones left without replies are removed up the thread.
 func (db *CommentsDB) Delete(ctx context.Context, id int) error {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, db.tracer,
-		"CommentStore.Delete")
-	defer span.Finish()
-	span.LogFields(
-		log.String("query", CommentDeleteByID),
-		log.String("arg0", strconv.Itoa(id)),
-	)
-	res, err := db.pool.Exec(ctx, CommentDeleteByID, id)
+	err := db.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// A reply added after the check would lose its parent or stay under a removed tombstone
+		err := tx.QueryRow(ctx, CommentLock, id).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: comment id %d", pgdb.ErrNotFound, id)
+		}
+		if err != nil {
+			return err
+		}
+		var replies bool
+		if err := tx.QueryRow(ctx, CommentHasReplies, id).Scan(&replies); err != nil {
+			return err
+		}
+		if replies {
+			res, err := tx.Exec(ctx, CommentTombstone, id, pgdb.ActorID(ctx))
+			if err == nil && res.RowsAffected() == 0 {
+				err = fmt.Errorf("%w: comment id %d", pgdb.ErrNotFound, id)
+			}
+			return err
+		}
+		var parentID int
+		err = tx.QueryRow(ctx, CommentDeleteReturning, id).Scan(&parentID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: comment id %d", pgdb.ErrNotFound, id)
+		}
+		for err == nil && parentID != 0 {
+			err = tx.QueryRow(ctx, CommentPrune, parentID).Scan(&parentID)
+		}
+		// Pruning stops at a live comment or a tombstone with other replies
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
 	if err != nil {
-		span.LogFields(log.Error(err))
+		err = pgdb.TranslateError(err)
 		return err
 	}
-	if rowsAffected := res.RowsAffected(); rowsAffected != 1 {
-		err = fmt.Errorf("delete comment error: %d rows affected", rowsAffected)
-		span.LogFields(log.Error(err))
-		return err
+	return nil
+}
+
+// Thread returns comments of a post the viewer of scope may see ordered by id,
+// so parents go before their replies. It fails with pgdb.ErrNotFound if the post
+// does not exist.
+func (db *CommentsDB) Thread(ctx context.Context, postID int, scope models.ListParams) ([]models.Comment, error) {
+	args := []interface{}{postID}
+	cond := commentScope(scope, func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	})
+	if cond != "" {
+		cond = " AND " + cond
 	}
-	span.LogFields(
-		log.String("Deleted comment with id", strconv.Itoa(id)),
+	query := fmt.Sprintf(CommentSelectThread, cond)
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	defer rows.Close()
+	comments := make([]models.Comment, 0)
+	for rows.Next() {
+		var comment models.Comment
+		if err := rows.Scan(commentFields(&comment)...); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	if len(comments) == 0 {
+		var exists bool
+		if err := db.pool.QueryRow(ctx, CommentPostExists, postID).Scan(&exists); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, err
+		}
+		if !exists {
+			err := fmt.Errorf("%w: post id %d", pgdb.ErrNotFound, postID)
+			return nil, err
+		}
+	}
+	return comments, nil
+}
+
+// List returns a page of comments and its metadata.
+func (db *CommentsDB) List(ctx context.Context, params models.ListParams) ([]models.Comment, *models.Page, error) {
+	params.Limit = pgdb.NormalizeLimit(params.Limit)
+	query, args, err := commentList.Query(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var (
+		comments = make([]models.Comment, 0, params.Limit+1)
+		total    int
 	)
-	return nil
+	for rows.Next() {
+		var comment models.Comment
+		if err := rows.Scan(append(commentFields(&comment), &total)...); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	n, page, err := commentList.Result(ctx, db.pool, params, len(comments), total, func(i int) interface{} { return comments[i] })
+	if err != nil {
+		return nil, nil, err
+	}
+	return comments[:n], page, nil
+}
+
+// ListByPost returns a page of comments of a post. Unlike List it fails with
+// pgdb.ErrNotFound if the post does not exist.
+func (db *CommentsDB) ListByPost(ctx context.Context, postID int, params models.ListParams) ([]models.Comment, *models.Page, error) {
+	filters := map[string]int{"post_id": postID}
+	for k, v := range params.Filters {
+		if k != "post_id" {
+			filters[k] = v
+		}
+	}
+	params.Filters = filters
+	comments, page, err := db.List(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	// An empty page is ambiguous, only then the post is looked up
+	if page.Total == 0 {
+		var exists bool
+		if err := db.pool.QueryRow(ctx, CommentPostExists, postID).Scan(&exists); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, nil, err
+		}
+		if !exists {
+			err := fmt.Errorf("%w: post id %d", pgdb.ErrNotFound, postID)
+			return nil, nil, err
+		}
+	}
+	return comments, page, nil
+}
+
+// commentFields returns scan destinations of CommentColumns
+func commentFields(comment *models.Comment) []interface{} {
+	return []interface{}{
+		&comment.Id, &comment.Body, &comment.BodyHTML, &comment.UserId, &comment.PostId, &comment.ParentId, &comment.Depth,
+		&comment.DeletedAt, &comment.Status, &comment.CreatedAt, &comment.UpdatedAt, &comment.UpdatedBy,
+	}
 }
@@ -0,0 +1,228 @@
+package commentstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+)
+
+const (
+	CommentPostModeration = `SELECT moderate_comments, COALESCE(user_id, 0) FROM posts WHERE id = $1;`
+	// CommentUserStanding counts approved and turned down comments of a user
+	CommentUserStanding = `
+SELECT count(*) FILTER (WHERE status = 'approved'), count(*) FILTER (WHERE status IN ('rejected', 'spam'))
+FROM comments WHERE user_id = $1;
+`
+	CommentCountPending = `SELECT count(*) FROM comments WHERE status = 'pending' AND deleted_at IS NULL;`
+	CommentSelectIDs    = `SELECT id FROM comments WHERE id = ANY($1) ORDER BY id;`
+	CommentSelectByIDs  = `SELECT ` + CommentColumns + ` FROM comments WHERE id = ANY($1) ORDER BY id;`
+	// CommentModerate changes statuses of comments and logs every change, comments
+	// already having the status are left as they are
+	CommentModerate = `
+WITH old AS (
+    SELECT id, status FROM comments WHERE id = ANY($1) FOR UPDATE
+), changed AS (
+    UPDATE comments c SET status = $2 FROM old
+    WHERE c.id = old.id AND old.status <> $2
+    RETURNING c.id, old.status
+)
+INSERT INTO comment_moderations(comment_id, from_status, status, reason, moderator_id)
+SELECT id, status, $2, $3, $4 FROM changed;
+`
+	// EditReason is logged for comments an edit sends back to moderation
+	EditReason = "edited"
+	// CommentQueueColumns add the spam check to CommentColumns
+	CommentQueueColumns      = CommentColumns + `, spam_score, spam_reasons`
+	CommentModerationColumns = `id, comment_id, from_status, status, reason, COALESCE(moderator_id, 0), created_at`
+)
+
+var commentModerationList = pgdb.List{
+	Table:   "comment_moderations",
+	Columns: CommentModerationColumns,
+	Sorts: map[string]pgdb.SortField{
+		"id":         {Column: "id", Type: "int"},
+		"created_at": {Column: "created_at", Type: "timestamptz"},
+	},
+	DefaultSort: "id",
+	Filters: map[string]string{
+		"comment_id":   "comment_id",
+		"moderator_id": "moderator_id",
+	},
+}
+
+// PostModeration returns the comment moderation setting of a post and its author.
+func (db *CommentsDB) PostModeration(ctx context.Context, postID int) (*bool, int, error) {
+	var (
+		moderate *bool
+		authorID int
+	)
+	err := db.pool.QueryRow(ctx, CommentPostModeration, postID).Scan(&moderate, &authorID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: post id %d", pgdb.ErrNotFound, postID)
+	}
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, 0, err
+	}
+	return moderate, authorID, nil
+}
+
+// UserStanding counts approved comments of a user and the ones rejected or marked as spam.
+func (db *CommentsDB) UserStanding(ctx context.Context, userID int) (int, int, error) {
+	var approved, flagged int
+	if err := db.pool.QueryRow(ctx, CommentUserStanding, userID).Scan(&approved, &flagged); err != nil {
+		err = pgdb.TranslateError(err)
+		return 0, 0, err
+	}
+	return approved, flagged, nil
+}
+
+// Queue returns a page of comments with the status and their spam checks,
+// the oldest ones go first by default.
+func (db *CommentsDB) Queue(ctx context.Context, status string, params models.ListParams) ([]models.QueuedComment, *models.Page, error) {
+	params.Limit = pgdb.NormalizeLimit(params.Limit)
+	list := commentList
+	list.Columns = CommentQueueColumns
+	list.Scope = func(_ models.ListParams, arg func(interface{}) string) string {
+		return "status = " + arg(status)
+	}
+	query, args, err := list.Query(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var (
+		comments = make([]models.QueuedComment, 0, params.Limit+1)
+		total    int
+	)
+	for rows.Next() {
+		var comment models.QueuedComment
+		if err := rows.Scan(append(commentFields(&comment.Comment), &comment.Spam.Score, &comment.Spam.Reasons, &total)...); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	// Cursors are made of columns of the comment itself
+	n, page, err := list.Result(ctx, db.pool, params, len(comments), total, func(i int) interface{} { return comments[i].Comment })
+	if err != nil {
+		return nil, nil, err
+	}
+	return comments[:n], page, nil
+}
+
+// Moderate sets the status of comments and logs the decision of the current user
+// with its reason. Either all comments are moderated or none of them.
+func (db *CommentsDB) Moderate(ctx context.Context, ids []int, status, reason string) ([]models.Comment, error) {
+	comments := make([]models.Comment, 0, len(ids))
+	err := db.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if err := checkIDs(ctx, tx, ids); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, CommentModerate, ids, status, reason, pgdb.ActorID(ctx)); err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, CommentSelectByIDs, ids)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var comment models.Comment
+			if err := rows.Scan(commentFields(&comment)...); err != nil {
+				return err
+			}
+			comments = append(comments, comment)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return comments, nil
+}
+
+// checkIDs fails with pgdb.ErrNotFound naming the first missing comment
+func checkIDs(ctx context.Context, tx pgx.Tx, ids []int) error {
+	rows, err := tx.Query(ctx, CommentSelectIDs, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	found := make(map[int]bool, len(ids))
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		found[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return fmt.Errorf("%w: comment id %d", pgdb.ErrNotFound, id)
+		}
+	}
+	return nil
+}
+
+// ModerationLog returns a page of moderation decisions, the oldest ones go first by default.
+func (db *CommentsDB) ModerationLog(ctx context.Context, params models.ListParams) ([]models.CommentModeration, *models.Page, error) {
+	params.Limit = pgdb.NormalizeLimit(params.Limit)
+	query, args, err := commentModerationList.Query(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var (
+		entries = make([]models.CommentModeration, 0, params.Limit+1)
+		total   int
+	)
+	for rows.Next() {
+		var m models.CommentModeration
+		if err := rows.Scan(&m.Id, &m.CommentId, &m.FromStatus, &m.Status, &m.Reason, &m.ModeratorId, &m.CreatedAt, &total); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, nil, err
+		}
+		entries = append(entries, m)
+	}
+	if err := rows.Err(); err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	n, page, err := commentModerationList.Result(ctx, db.pool, params, len(entries), total, func(i int) interface{} { return entries[i] })
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries[:n], page, nil
+}
+
+// CountPending counts comments waiting for moderation.
+func (db *CommentsDB) CountPending(ctx context.Context) (int, error) {
+	var n int
+	if err := db.pool.QueryRow(ctx, CommentCountPending).Scan(&n); err != nil {
+		err = pgdb.TranslateError(err)
+		return 0, err
+	}
+	return n, nil
+}
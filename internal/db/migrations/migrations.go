@@ -0,0 +1,296 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// LockKey is the key of the Postgres advisory lock held while migrating,
+// so several instances started at once don't apply the same migration twice.
+const LockKey int64 = 0x626c6f676d6967 // "blogmig"
+
+const (
+	CreateMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations
+(
+	version INT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+`
+	MigrationsSelect = `SELECT version, name, checksum FROM schema_migrations ORDER BY version;`
+	MigrationInsert  = `INSERT INTO schema_migrations(version, name, checksum) VALUES ($1, $2, $3);`
+	MigrationDelete  = `DELETE FROM schema_migrations WHERE version = $1;`
+)
+
+var (
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrUnknownVersion   = errors.New("unknown version")
+	ErrNoDown           = errors.New("no down migration")
+)
+
+//go:embed sql/*.sql
+var embedded embed.FS
+
+var fileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type Applied struct {
+	Version  int
+	Name     string
+	Checksum string
+}
+
+// Load reads migrations named like 0001_init.up.sql / 0001_init.down.sql from fsys root.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		m := fileRe.FindStringSubmatch(path.Base(file))
+		if m == nil {
+			return nil, fmt.Errorf("bad migration file name: %s", file)
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has different names: %s, %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(data)
+			sum := sha256.Sum256(data)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(data)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+type Migrator struct {
+	pool       *pgxpool.Pool
+	logger     *zap.Logger
+	migrations []Migration
+}
+
+// NewMigrator creates a Migrator with migrations embedded into the binary.
+func NewMigrator(p *pgxpool.Pool, l *zap.Logger) (*Migrator, error) {
+	sub, err := fs.Sub(embedded, "sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Load(sub)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load migrations: %w", err)
+	}
+	return &Migrator{
+		pool:       p,
+		logger:     l,
+		migrations: migrations,
+	}, nil
+}
+
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Up applies all pending migrations and returns the number of applied ones.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	var count int
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.verify(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			m.logger.Info("applying migration", zap.Int("version", mig.Version), zap.String("name", mig.Name))
+			err := conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, MigrationInsert, mig.Version, mig.Name, mig.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down reverts the last steps applied migrations and returns the number of reverted ones.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	var count int
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.verify(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("%w: %d_%s", ErrNoDown, mig.Version, mig.Name)
+			}
+			m.logger.Info("reverting migration", zap.Int("version", mig.Version), zap.String("name", mig.Name))
+			err := conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, MigrationDelete, mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s revert failed: %w", mig.Version, mig.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Pending returns migrations which are not applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+	applied, err := m.verify(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]Migration, 0)
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+// Check returns an error if the schema is not up to date.
+func (m *Migrator) Check(ctx context.Context) error {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d of %d migrations pending", len(pending), len(m.migrations))
+	}
+	return nil
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot acquire connection: %w", err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1);`, LockKey); err != nil {
+		return fmt.Errorf("cannot take migration lock: %w", err)
+	}
+	defer func() {
+		// The lock must be released even if ctx is already canceled
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1);`, LockKey); err != nil {
+			m.logger.Error("cannot release migration lock", zap.Error(err))
+		}
+	}()
+	if _, err := conn.Exec(ctx, CreateMigrationsTable); err != nil {
+		return fmt.Errorf("cannot create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// verify checks that applied migrations are known and not changed since they were applied.
+func (m *Migrator) verify(ctx context.Context, conn *pgxpool.Conn) (map[int]Applied, error) {
+	applied, err := readApplied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int]Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+	for version, a := range applied {
+		mig, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d_%s is applied but not found", ErrUnknownVersion, a.Version, a.Name)
+		}
+		if mig.Checksum != a.Checksum {
+			return nil, fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, mig.Version, mig.Name)
+		}
+	}
+	return applied, nil
+}
+
+func readApplied(ctx context.Context, conn *pgxpool.Conn) (map[int]Applied, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL;`).Scan(&exists); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]Applied)
+	if !exists {
+		return applied, nil
+	}
+	rows, err := conn.Query(ctx, MigrationsSelect)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a Applied
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum); err != nil {
+			return nil, err
+		}
+		applied[a.Version] = a
+	}
+	return applied, rows.Err()
+}
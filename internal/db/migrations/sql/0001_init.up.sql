@@ -0,0 +1,31 @@
+-- Create extension to use cryptography functions in queries
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+CREATE TABLE IF NOT EXISTS users
+(
+	id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+	username VARCHAR(100) NOT NULL UNIQUE,
+	password VARCHAR(100) NOT NULL,
+	first_name VARCHAR(100),
+	last_name VARCHAR(100),
+	email VARCHAR(100),
+	is_active BOOL
+);
+CREATE TABLE IF NOT EXISTS posts
+(
+	id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+	title VARCHAR(255) NOT NULL UNIQUE,
+	body TEXT NOT NULL,
+	user_id INT,
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL ON UPDATE CASCADE
+);
+CREATE TABLE IF NOT EXISTS comments
+(
+	id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+	date TIMESTAMP WITHOUT TIME ZONE DEFAULT NOW(),
+	body TEXT NOT NULL,
+	user_id INT,
+	post_id INT,
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL ON UPDATE CASCADE,
+	FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
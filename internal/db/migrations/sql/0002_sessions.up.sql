@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS sessions
+(
+	-- sha256 of the token from the cookie, the token itself is never stored
+	id CHAR(64) PRIMARY KEY,
+	user_id INT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions (expires_at);
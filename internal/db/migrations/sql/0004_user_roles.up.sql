@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'commenter';
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('admin', 'editor', 'author', 'commenter'));
+-- Existing users keep their abilities: whoever has posts is an author, admin is an admin
+UPDATE users SET role = 'author' WHERE id IN (SELECT DISTINCT user_id FROM posts WHERE user_id IS NOT NULL);
+UPDATE users SET role = 'admin' WHERE username = 'admin';
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS posts_status_idx;
+DROP INDEX IF EXISTS posts_scheduled_idx;
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_scheduled_check;
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_status_check;
+ALTER TABLE posts DROP COLUMN IF EXISTS published_at;
+ALTER TABLE posts DROP COLUMN IF EXISTS status;
@@ -0,0 +1,11 @@
+-- Existing posts were public, so they are published; new posts start as drafts
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'published';
+ALTER TABLE posts ALTER COLUMN status SET DEFAULT 'draft';
+ALTER TABLE posts ADD CONSTRAINT posts_status_check CHECK (status IN ('draft', 'scheduled', 'published', 'archived'));
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS published_at TIMESTAMPTZ;
+UPDATE posts SET published_at = NOW() WHERE status = 'published' AND published_at IS NULL;
+-- A scheduled post needs the time to be published at
+ALTER TABLE posts ADD CONSTRAINT posts_scheduled_check CHECK (status <> 'scheduled' OR published_at IS NOT NULL);
+-- The scheduler looks for due posts only
+CREATE INDEX IF NOT EXISTS posts_scheduled_idx ON posts (published_at) WHERE status = 'scheduled';
+CREATE INDEX IF NOT EXISTS posts_status_idx ON posts (status);
@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS comments_created_at_idx;
+DROP INDEX IF EXISTS posts_updated_at_idx;
+DROP INDEX IF EXISTS posts_created_at_idx;
+DROP INDEX IF EXISTS users_created_at_idx;
+ALTER TABLE comments DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE posts DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE users DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE comments DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE posts DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE users DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE posts DROP COLUMN IF EXISTS created_at;
+ALTER TABLE users DROP COLUMN IF EXISTS created_at;
+ALTER TABLE comments ALTER COLUMN created_at DROP NOT NULL;
+ALTER TABLE comments ALTER COLUMN created_at TYPE TIMESTAMP WITHOUT TIME ZONE USING created_at AT TIME ZONE 'Asia/Yekaterinburg';
+ALTER TABLE comments RENAME COLUMN created_at TO date;
@@ -0,0 +1,29 @@
+-- Comments keep their dates as created_at. Old values are local times of the
+-- Asia/Yekaterinburg session time zone the schema used to be created with.
+ALTER TABLE comments RENAME COLUMN date TO created_at;
+ALTER TABLE comments ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'Asia/Yekaterinburg';
+UPDATE comments SET created_at = NOW() WHERE created_at IS NULL;
+ALTER TABLE comments ALTER COLUMN created_at SET DEFAULT NOW();
+ALTER TABLE comments ALTER COLUMN created_at SET NOT NULL;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+-- Published posts existed before their publication
+UPDATE posts SET created_at = published_at WHERE published_at IS NOT NULL AND published_at < created_at;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+UPDATE users SET updated_at = created_at;
+UPDATE posts SET updated_at = created_at;
+UPDATE comments SET updated_at = created_at;
+
+-- updated_by is NULL for changes made by the system, e.g. scheduled publishing
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_by INT REFERENCES users (id) ON DELETE SET NULL;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS updated_by INT REFERENCES users (id) ON DELETE SET NULL;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS updated_by INT REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS users_created_at_idx ON users (created_at);
+CREATE INDEX IF NOT EXISTS posts_created_at_idx ON posts (created_at);
+CREATE INDEX IF NOT EXISTS posts_updated_at_idx ON posts (updated_at);
+CREATE INDEX IF NOT EXISTS comments_created_at_idx ON comments (created_at);
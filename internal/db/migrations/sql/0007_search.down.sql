@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS comments_search_idx;
+DROP INDEX IF EXISTS posts_search_idx;
+DROP TRIGGER IF EXISTS comments_search_trigger ON comments;
+DROP TRIGGER IF EXISTS posts_search_trigger ON posts;
+ALTER TABLE comments DROP COLUMN IF EXISTS search;
+ALTER TABLE posts DROP COLUMN IF EXISTS search;
+DROP FUNCTION IF EXISTS comments_search_update();
+DROP FUNCTION IF EXISTS posts_search_update();
+DROP FUNCTION IF EXISTS comments_search_vector(TEXT);
+DROP FUNCTION IF EXISTS posts_search_vector(TEXT, TEXT);
+DROP FUNCTION IF EXISTS search_language();
+DROP TABLE IF EXISTS search_settings;
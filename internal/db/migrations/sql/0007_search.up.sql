@@ -0,0 +1,55 @@
+-- The text search language of the stored vectors, it is kept in sync with the config on startup.
+-- The russian configuration also stems English words.
+CREATE TABLE IF NOT EXISTS search_settings
+(
+	id BOOL PRIMARY KEY DEFAULT TRUE CHECK (id),
+	language REGCONFIG NOT NULL DEFAULT 'russian'
+);
+INSERT INTO search_settings (id) VALUES (TRUE) ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION search_language() RETURNS REGCONFIG
+	LANGUAGE sql STABLE
+AS $$ SELECT language FROM search_settings $$;
+
+-- Titles weigh more than bodies
+CREATE OR REPLACE FUNCTION posts_search_vector(title TEXT, body TEXT) RETURNS TSVECTOR
+	LANGUAGE sql STABLE
+AS $$
+	SELECT setweight(to_tsvector(search_language(), COALESCE(title, '')), 'A') ||
+		setweight(to_tsvector(search_language(), COALESCE(body, '')), 'B')
+$$;
+
+CREATE OR REPLACE FUNCTION comments_search_vector(body TEXT) RETURNS TSVECTOR
+	LANGUAGE sql STABLE
+AS $$ SELECT setweight(to_tsvector(search_language(), COALESCE(body, '')), 'B') $$;
+
+CREATE OR REPLACE FUNCTION posts_search_update() RETURNS TRIGGER
+	LANGUAGE plpgsql
+AS $$
+BEGIN
+	NEW.search := posts_search_vector(NEW.title, NEW.body);
+	RETURN NEW;
+END
+$$;
+
+CREATE OR REPLACE FUNCTION comments_search_update() RETURNS TRIGGER
+	LANGUAGE plpgsql
+AS $$
+BEGIN
+	NEW.search := comments_search_vector(NEW.body);
+	RETURN NEW;
+END
+$$;
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search TSVECTOR;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS search TSVECTOR;
+UPDATE posts SET search = posts_search_vector(title, body);
+UPDATE comments SET search = comments_search_vector(body);
+
+CREATE TRIGGER posts_search_trigger BEFORE INSERT OR UPDATE OF title, body ON posts
+	FOR EACH ROW EXECUTE FUNCTION posts_search_update();
+CREATE TRIGGER comments_search_trigger BEFORE INSERT OR UPDATE OF body ON comments
+	FOR EACH ROW EXECUTE FUNCTION comments_search_update();
+
+CREATE INDEX IF NOT EXISTS posts_search_idx ON posts USING GIN (search);
+CREATE INDEX IF NOT EXISTS comments_search_idx ON comments USING GIN (search);
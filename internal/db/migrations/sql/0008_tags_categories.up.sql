@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS tags
+(
+	id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+	name VARCHAR(100) NOT NULL,
+	slug VARCHAR(100) NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_by INT REFERENCES users (id) ON DELETE SET NULL
+);
+CREATE TABLE IF NOT EXISTS post_tags
+(
+	post_id INT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	tag_id INT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+	PRIMARY KEY (post_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS post_tags_tag_id_idx ON post_tags (tag_id);
+
+-- A category with subcategories or posts cannot be deleted
+CREATE TABLE IF NOT EXISTS categories
+(
+	id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+	name VARCHAR(100) NOT NULL,
+	slug VARCHAR(100) NOT NULL UNIQUE,
+	parent_id INT REFERENCES categories (id) ON DELETE RESTRICT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_by INT REFERENCES users (id) ON DELETE SET NULL,
+	CONSTRAINT categories_parent_check CHECK (parent_id <> id)
+);
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS category_id INT REFERENCES categories (id) ON DELETE RESTRICT;
+CREATE INDEX IF NOT EXISTS posts_category_id_idx ON posts (category_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS post_slugs;
+ALTER TABLE posts ADD CONSTRAINT posts_title_key UNIQUE (title);
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_slug_key;
+ALTER TABLE posts DROP COLUMN IF EXISTS slug;
@@ -0,0 +1,38 @@
+-- slugify is a rough SQL copy of slug.Make to fill slugs of existing posts
+CREATE FUNCTION pg_temp.slugify(s TEXT) RETURNS TEXT
+	LANGUAGE sql IMMUTABLE AS
+$$
+	SELECT rtrim(left(trim(BOTH '-' FROM regexp_replace(
+		translate(
+			replace(replace(replace(replace(replace(replace(replace(replace(replace(replace(replace(replace(
+				lower(s), 'ж', 'zh'), 'х', 'kh'), 'ц', 'ts'), 'ч', 'ch'), 'щ', 'shch'), 'ш', 'sh'),
+				'ю', 'yu'), 'я', 'ya'), 'ї', 'yi'), 'є', 'ye'), 'ъ', ''), 'ь', ''),
+			'абвгдеёзийклмнопрстуфыэіґў', 'abvgdeeziyklmnoprstufyeigu'),
+		'[^[:alnum:]]+', '-', 'g')), 100), '-');
+$$;
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS slug VARCHAR(255);
+-- Titles were unique, but their slugs may clash, later posts get their id as a suffix
+UPDATE posts SET slug = s.slug
+FROM (
+	SELECT id, CASE
+		WHEN pg_temp.slugify(title) = '' THEN 'post-' || id
+		WHEN row_number() OVER (PARTITION BY pg_temp.slugify(title) ORDER BY id) > 1
+			THEN pg_temp.slugify(title) || '-' || id
+		ELSE pg_temp.slugify(title)
+	END AS slug
+	FROM posts
+) s
+WHERE posts.id = s.id;
+ALTER TABLE posts ALTER COLUMN slug SET NOT NULL;
+ALTER TABLE posts ADD CONSTRAINT posts_slug_key UNIQUE (slug);
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_title_key;
+
+-- Old slugs of renamed posts, they redirect to the current slug
+CREATE TABLE IF NOT EXISTS post_slugs
+(
+	slug VARCHAR(255) PRIMARY KEY,
+	post_id INT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS post_slugs_post_id_idx ON post_slugs (post_id);
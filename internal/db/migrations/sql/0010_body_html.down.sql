@@ -0,0 +1,2 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS body_html;
+ALTER TABLE posts DROP COLUMN IF EXISTS body_html;
@@ -0,0 +1,13 @@
+-- Bodies are Markdown, body_html is rendered by the application.
+-- Existing bodies were plain text, they are kept as escaped paragraphs.
+CREATE FUNCTION pg_temp.plain_html(s TEXT) RETURNS TEXT
+	LANGUAGE sql IMMUTABLE AS
+$$
+	SELECT '<p>' || replace(replace(replace(replace(replace(s,
+		'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), E'\n', '<br>') || '</p>';
+$$;
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS body_html TEXT NOT NULL DEFAULT '';
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS body_html TEXT NOT NULL DEFAULT '';
+UPDATE posts SET body_html = pg_temp.plain_html(body);
+UPDATE comments SET body_html = pg_temp.plain_html(body);
@@ -0,0 +1,25 @@
+-- Every write of a post appends its new state, revisions are never changed
+CREATE TABLE IF NOT EXISTS post_revisions
+(
+	id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+	post_id INT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	rev INT NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	slug VARCHAR(255) NOT NULL,
+	body TEXT NOT NULL,
+	status VARCHAR(20) NOT NULL,
+	published_at TIMESTAMPTZ,
+	-- Not a reference, categories of old revisions may be gone
+	category_id INT,
+	tags TEXT[] NOT NULL DEFAULT '{}',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	created_by INT REFERENCES users (id) ON DELETE SET NULL,
+	CONSTRAINT post_revisions_rev_key UNIQUE (post_id, rev)
+);
+
+-- The current state of existing posts is their first revision
+INSERT INTO post_revisions(post_id, rev, title, slug, body, status, published_at, category_id, tags, created_at, created_by)
+SELECT p.id, 1, p.title, p.slug, p.body, p.status, p.published_at, p.category_id,
+	ARRAY(SELECT t.slug FROM post_tags pt JOIN tags t ON t.id = pt.tag_id WHERE pt.post_id = p.id ORDER BY t.slug),
+	p.updated_at, p.updated_by
+FROM posts p;
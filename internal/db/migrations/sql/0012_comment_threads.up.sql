@@ -0,0 +1,7 @@
+-- Replies are never cascaded away with their parent, deleted parents are kept as tombstones.
+-- The check is deferred to the end of the statement, so posts still delete all their comments.
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES comments (id) ON DELETE NO ACTION;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS depth INT NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE comments ADD CONSTRAINT comments_parent_check CHECK (parent_id <> id);
+CREATE INDEX IF NOT EXISTS comments_parent_id_idx ON comments (parent_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS comment_moderations;
+ALTER TABLE posts DROP COLUMN IF EXISTS moderate_comments;
+DROP INDEX IF EXISTS comments_pending_idx;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_status_check;
+ALTER TABLE comments DROP COLUMN IF EXISTS status;
@@ -0,0 +1,23 @@
+-- Existing comments were public, so they are approved; new comments wait for the application to decide
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'approved';
+ALTER TABLE comments ALTER COLUMN status SET DEFAULT 'pending';
+ALTER TABLE comments ADD CONSTRAINT comments_status_check CHECK (status IN ('pending', 'approved', 'rejected', 'spam'));
+-- Moderators look through the queue oldest first
+CREATE INDEX IF NOT EXISTS comments_pending_idx ON comments (created_at) WHERE status = 'pending';
+
+-- NULL follows the global setting
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS moderate_comments BOOLEAN;
+
+-- Every decision of a moderator is kept, even after the comment is deleted
+CREATE TABLE IF NOT EXISTS comment_moderations
+(
+	id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+	-- Not a reference, deleted comments keep their history
+	comment_id INT NOT NULL,
+	from_status VARCHAR(20) NOT NULL,
+	status VARCHAR(20) NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	moderator_id INT REFERENCES users (id) ON DELETE SET NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS comment_moderations_comment_id_idx ON comment_moderations (comment_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS spam_tokens;
+DROP TABLE IF EXISTS spam_training;
+DROP INDEX IF EXISTS comments_body_md5_idx;
+ALTER TABLE comments DROP COLUMN IF EXISTS spam_reasons;
+ALTER TABLE comments DROP COLUMN IF EXISTS spam_score;
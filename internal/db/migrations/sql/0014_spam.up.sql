@@ -0,0 +1,23 @@
+-- Scores are kept for moderators to review, they are never shown in public reads
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS spam_score REAL NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS spam_reasons TEXT[] NOT NULL DEFAULT '{}';
+-- Duplicates are found by the hash of the body with collapsed whitespace
+CREATE INDEX IF NOT EXISTS comments_body_md5_idx ON comments (md5(lower(btrim(regexp_replace(body, '\s+', ' ', 'g')))));
+
+-- Comments the classifier learned from, tokens are kept to unlearn them when a decision changes.
+-- Not a reference, counts of deleted comments stay learned.
+CREATE TABLE IF NOT EXISTS spam_training
+(
+	comment_id INT PRIMARY KEY,
+	spam BOOLEAN NOT NULL,
+	tokens TEXT[] NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Numbers of spam and ham comments with a token
+CREATE TABLE IF NOT EXISTS spam_tokens
+(
+	token TEXT PRIMARY KEY,
+	spam INT NOT NULL DEFAULT 0,
+	ham INT NOT NULL DEFAULT 0
+);
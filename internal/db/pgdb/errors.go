@@ -0,0 +1,75 @@
+package pgdb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"regexp"
+	"strings"
+)
+
+// SQLSTATE codes translated into domain errors
+const (
+	codeUniqueViolation     = "23505"
+	codeForeignKeyViolation = "23503"
+	codeNotNullViolation    = "23502"
+	codeCheckViolation      = "23514"
+	codeInvalidText         = "22P02"
+	codeStringTooLong       = "22001"
+)
+
+// detailKey extracts column names from details like "Key (username)=(admin) already exists."
+var detailKey = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// TranslateError turns pgx and pgconn errors into apperr errors, so the layers above
+// do not depend on the database. Values of the violating keys are not copied into the error.
+func TranslateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apperr.Wrap(err, apperr.KindNotFound, "not_found", "not found")
+	}
+	if errors.Is(err, ErrNoFields) {
+		return apperr.Wrap(err, apperr.KindValidation, "no_fields", "no fields to update")
+	}
+	if errors.Is(err, ErrUnknownField) {
+		return apperr.Wrap(err, apperr.KindValidation, "unknown_field", err.Error())
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	field := pgErr.ColumnName
+	if m := detailKey.FindStringSubmatch(pgErr.Detail); m != nil {
+		field = m[1]
+	}
+	var res *apperr.Error
+	switch pgErr.Code {
+	case codeUniqueViolation:
+		res = apperr.Wrap(err, apperr.KindConflict, "unique_violation", fmt.Sprintf("%s already exists", field))
+	case codeForeignKeyViolation:
+		if strings.Contains(pgErr.Detail, "still referenced") {
+			res = apperr.Wrap(err, apperr.KindConflict, "still_referenced", fmt.Sprintf("%s is still referenced", pgErr.TableName))
+		} else {
+			res = apperr.Wrap(err, apperr.KindValidation, "foreign_key_violation", fmt.Sprintf("%s refers to a missing row", field))
+		}
+	case codeNotNullViolation:
+		res = apperr.Wrap(err, apperr.KindValidation, "not_null_violation", fmt.Sprintf("%s is required", field))
+	case codeCheckViolation:
+		res = apperr.Wrap(err, apperr.KindValidation, "check_violation", fmt.Sprintf("%s violates %s", pgErr.TableName, pgErr.ConstraintName))
+	case codeInvalidText, codeStringTooLong:
+		res = apperr.Wrap(err, apperr.KindValidation, "invalid_value", pgErr.Message)
+	default:
+		return err
+	}
+	if field != "" {
+		res = res.WithDetails("field", field)
+	}
+	if pgErr.ConstraintName != "" {
+		res = res.WithDetails("constraint", pgErr.ConstraintName)
+	}
+	return res
+}
@@ -0,0 +1,264 @@
+package pgdb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var ErrBadCursor = apperr.Validation("bad_cursor", "bad cursor")
+
+// Querier runs queries on a pool or in a transaction.
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// SortField is a column a list may be sorted by. Type is the SQL type
+// cursor values are cast to, e.g. "int", "text" or "timestamptz".
+type SortField struct {
+	Column string
+	Type   string
+}
+
+// List builds queries of paginated lists. Only whitelisted sort fields and filters
+// get into SQL, their values are always passed as args.
+type List struct {
+	Table       string
+	Columns     string
+	Sorts       map[string]SortField
+	DefaultSort string
+	// Filters maps filter names to columns compared for equality, or to conditions
+	// where %s is replaced with the value placeholder, e.g. "id IN (SELECT ... = %s)"
+	Filters map[string]string
+	// Scope returns an extra condition on the rows a viewer may see, arg adds
+	// an arg and returns its placeholder
+	Scope func(p models.ListParams, arg func(interface{}) string) string
+}
+
+// cursor points at the last row of a page, the next page starts right after it.
+// Id breaks ties between rows with equal sort values.
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	Id    int    `json:"id"`
+}
+
+// Query returns the query of a page and its args. Every row is followed by the total
+// number of rows matching the filters. Limit+1 rows are fetched, an extra row
+// means there is a next page.
+func (l List) Query(p models.ListParams) (string, []interface{}, error) {
+	sortName := p.Sort
+	if sortName == "" {
+		sortName = l.DefaultSort
+	}
+	field, ok := l.Sorts[sortName]
+	if !ok {
+		return "", nil, apperr.Validation("unknown_sort", fmt.Sprintf("cannot sort by %s", sortName)).
+			WithDetails("sort", sortName)
+	}
+	where, args, err := l.conditions(p)
+	if err != nil {
+		return "", nil, err
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+	total := fmt.Sprintf("(SELECT count(*) FROM %s%s)", l.Table, filter)
+
+	op, dir := ">", "ASC"
+	if p.Desc {
+		op, dir = "<", "DESC"
+	}
+	if p.Cursor != "" {
+		c, err := decodeCursor(p.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		if c.Sort != sortName || c.Desc != p.Desc {
+			return "", nil, ErrBadCursor.WithDetails("reason", "cursor belongs to another sort order")
+		}
+		args = append(args, c.Value, c.Id)
+		where = append(where, fmt.Sprintf("(%s, id) %s ($%d::text::%s, $%d)",
+			field.Column, op, len(args)-1, field.Type, len(args)))
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	args = append(args, p.Limit+1)
+	query := fmt.Sprintf("SELECT %s, %s FROM %s%s ORDER BY %s %s, id %s LIMIT $%d",
+		l.Columns, total, l.Table, cond, field.Column, dir, dir, len(args))
+	if p.Cursor == "" && p.Offset > 0 {
+		args = append(args, p.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+	return query + ";", args, nil
+}
+
+// Count returns the query of the number of rows matching the filters and its args.
+func (l List) Count(p models.ListParams) (string, []interface{}, error) {
+	where, args, err := l.conditions(p)
+	if err != nil {
+		return "", nil, err
+	}
+	query := "SELECT count(*) FROM " + l.Table
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	return query + ";", args, nil
+}
+
+// Result returns how many of n fetched rows belong to the page and its metadata,
+// the extra row fetched by Query is left out. row returns the fetched row i, the last row
+// of the page makes the next cursor. No row carries the total when the page is empty,
+// e.g. its offset is past the end, so it is counted with q then.
+func (l List) Result(ctx context.Context, q Querier, p models.ListParams, n, total int, row func(i int) interface{}) (int, *models.Page, error) {
+	more := n > p.Limit
+	if more {
+		n = p.Limit
+	}
+	var last interface{}
+	if n > 0 {
+		last = row(n - 1)
+	} else if p.Offset > 0 || p.Cursor != "" {
+		query, args, err := l.Count(p)
+		if err != nil {
+			return 0, nil, err
+		}
+		if err := q.QueryRow(ctx, query, args...).Scan(&total); err != nil {
+			return 0, nil, TranslateError(err)
+		}
+	}
+	page, err := l.Page(p, total, more, last)
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, page, nil
+}
+
+// Page returns the metadata of a page. last is the last row of the page, it is used
+// for the next cursor when there are more rows.
+func (l List) Page(p models.ListParams, total int, more bool, last interface{}) (*models.Page, error) {
+	page := &models.Page{
+		Limit:   p.Limit,
+		Offset:  p.Offset,
+		Total:   total,
+		HasMore: more,
+	}
+	if p.Cursor != "" {
+		page.Offset = 0
+	}
+	if !more || last == nil {
+		return page, nil
+	}
+	sortName := p.Sort
+	if sortName == "" {
+		sortName = l.DefaultSort
+	}
+	v := reflect.Indirect(reflect.ValueOf(last))
+	columns := structColumns(v.Type())
+	idx, ok := columns[sortName]
+	if !ok {
+		return nil, fmt.Errorf("no field %s in %s", sortName, v.Type())
+	}
+	id, ok := columns["id"]
+	if !ok {
+		return nil, fmt.Errorf("no id in %s", v.Type())
+	}
+	page.NextCursor = encodeCursor(cursor{
+		Sort:  sortName,
+		Desc:  p.Desc,
+		Value: cursorValue(v.Field(idx).Interface()),
+		Id:    int(v.Field(id).Int()),
+	})
+	return page, nil
+}
+
+// conditions returns the filters and the scope of a list as SQL conditions and their args.
+func (l List) conditions(p models.ListParams) ([]string, []interface{}, error) {
+	var (
+		args  []interface{}
+		where []string
+	)
+	names := make([]string, 0, len(p.Filters))
+	for name := range p.Filters {
+		names = append(names, name)
+	}
+	// Stable order of args gives stable query texts for prepared statements
+	sort.Strings(names)
+	for _, name := range names {
+		column, ok := l.Filters[name]
+		if !ok {
+			return nil, nil, apperr.Validation("unknown_filter", fmt.Sprintf("cannot filter by %s", name)).
+				WithDetails("filter", name)
+		}
+		args = append(args, p.Filters[name])
+		if strings.Contains(column, "%s") {
+			where = append(where, fmt.Sprintf(column, fmt.Sprintf("$%d", len(args))))
+			continue
+		}
+		where = append(where, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if l.Scope != nil {
+		arg := func(v interface{}) string {
+			args = append(args, v)
+			return fmt.Sprintf("$%d", len(args))
+		}
+		if cond := l.Scope(p, arg); cond != "" {
+			where = append(where, cond)
+		}
+	}
+	return where, args, nil
+}
+
+// NormalizeLimit applies the default and the maximum page size.
+func NormalizeLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultLimit
+	}
+	if limit > MaxLimit {
+		return MaxLimit
+	}
+	return limit
+}
+
+func cursorValue(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		// The offset is kept, timestamptz casts compare the same instant
+		return t.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrBadCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrBadCursor
+	}
+	return c, nil
+}
@@ -0,0 +1,98 @@
+package pgdb
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"reflect"
+	"testing"
+)
+
+type testRow struct {
+	Id    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+var testList = List{
+	Table:       "posts",
+	Columns:     "id, title",
+	Sorts:       map[string]SortField{"id": {Column: "id", Type: "int"}},
+	DefaultSort: "id",
+	Filters:     map[string]string{"user_id": "user_id"},
+	Scope: func(_ models.ListParams, arg func(interface{}) string) string {
+		return "status = " + arg("published")
+	},
+}
+
+// countingQuerier answers count queries with its total and records them.
+type countingQuerier struct {
+	total   int
+	queries []string
+}
+
+func (q *countingQuerier) QueryRow(_ context.Context, sql string, _ ...interface{}) pgx.Row {
+	q.queries = append(q.queries, sql)
+	return countRow(q.total)
+}
+
+type countRow int
+
+func (r countRow) Scan(dest ...interface{}) error {
+	*dest[0].(*int) = int(r)
+	return nil
+}
+
+func TestListCount(t *testing.T) {
+	query, args, err := testList.Count(models.ListParams{Limit: 10, Offset: 20, Filters: map[string]int{"user_id": 3}})
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	want := "SELECT count(*) FROM posts WHERE user_id = $1 AND status = $2;"
+	if query != want {
+		t.Errorf("query = %q, want %q", query, want)
+	}
+	if wantArgs := []interface{}{3, "published"}; !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %v, want %v", args, wantArgs)
+	}
+}
+
+func TestListResult(t *testing.T) {
+	rows := []testRow{{1, "a"}, {2, "b"}, {3, "c"}}
+	tests := []struct {
+		name      string
+		params    models.ListParams
+		fetched   int
+		total     int
+		wantN     int
+		wantTotal int
+		wantMore  bool
+		wantCount bool
+	}{
+		{"full page with more", models.ListParams{Limit: 2}, 3, 5, 2, 5, true, false},
+		{"last page", models.ListParams{Limit: 2, Offset: 4}, 1, 5, 1, 5, false, false},
+		{"empty list", models.ListParams{Limit: 2}, 0, 0, 0, 0, false, false},
+		{"offset past the end", models.ListParams{Limit: 2, Offset: 10}, 0, 0, 0, 5, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &countingQuerier{total: 5}
+			n, page, err := testList.Result(context.Background(), q, tt.params, tt.fetched, tt.total,
+				func(i int) interface{} { return rows[i] })
+			if err != nil {
+				t.Fatalf("Result() error = %v", err)
+			}
+			if n != tt.wantN {
+				t.Errorf("n = %d, want %d", n, tt.wantN)
+			}
+			if page.Total != tt.wantTotal || page.HasMore != tt.wantMore {
+				t.Errorf("page = %+v, want total %d and more %v", page, tt.wantTotal, tt.wantMore)
+			}
+			if (page.NextCursor != "") != tt.wantMore {
+				t.Errorf("next cursor = %q, want one only with more rows", page.NextCursor)
+			}
+			if (len(q.queries) > 0) != tt.wantCount {
+				t.Errorf("count queries = %v, want counted %v", q.queries, tt.wantCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package pgdb
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/ptsypyshev/simple-blog/internal/auth"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"github.com/ptsypyshev/simple-blog/internal/redact"
+)
+
+// redactingLogger hides arguments of statements dealing with credentials,
+// e.g. the plain password passed to crypt() on user create.
+type redactingLogger struct {
+	pgx.Logger
+}
+
+func (l redactingLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	if sql, ok := data["sql"].(string); ok && redact.IsSensitive(sql) {
+		if _, ok := data["args"]; ok {
+			safe := make(map[string]interface{}, len(data))
+			for k, v := range data {
+				safe[k] = v
+			}
+			safe["args"] = redact.Placeholder
+			data = safe
+		}
+	}
+	l.Logger.Log(ctx, level, msg, data)
+}
+
+// requestLogger adds ids of the request and the user to statements,
+// so statements of a request are found by its id.
+type requestLogger struct {
+	pgx.Logger
+}
+
+func (l requestLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	if id := logctx.RequestID(ctx); id != "" {
+		withIDs := make(map[string]interface{}, len(data)+2)
+		for k, v := range data {
+			withIDs[k] = v
+		}
+		withIDs["request_id"] = id
+		if userID, ok := auth.UserID(ctx); ok {
+			withIDs["user_id"] = userID
+		}
+		data = withIDs
+	}
+	l.Logger.Log(ctx, level, msg, data)
+}
@@ -0,0 +1,110 @@
+package pgdb
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/ptsypyshev/simple-blog/internal/auth"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"github.com/ptsypyshev/simple-blog/internal/redact"
+	"reflect"
+	"testing"
+)
+
+type recordingLogger struct {
+	data map[string]interface{}
+}
+
+func (l *recordingLogger) Log(_ context.Context, _ pgx.LogLevel, _ string, data map[string]interface{}) {
+	l.data = data
+}
+
+func TestRedactingLogger(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			"user create",
+			map[string]interface{}{
+				"sql":  "INSERT INTO users(username, password) VALUES ($1, crypt($2, gen_salt('bf', 8)))",
+				"args": []interface{}{"admin", "secret"},
+			},
+			map[string]interface{}{
+				"sql":  "INSERT INTO users(username, password) VALUES ($1, crypt($2, gen_salt('bf', 8)))",
+				"args": redact.Placeholder,
+			},
+		},
+		{
+			"login",
+			map[string]interface{}{
+				"sql":  "SELECT id FROM users WHERE username = $1 AND password = crypt($2, password)",
+				"args": []interface{}{"admin", "secret"},
+				"time": 1,
+			},
+			map[string]interface{}{
+				"sql":  "SELECT id FROM users WHERE username = $1 AND password = crypt($2, password)",
+				"args": redact.Placeholder,
+				"time": 1,
+			},
+		},
+		{
+			"refresh token",
+			map[string]interface{}{
+				"sql":  "SELECT user_id FROM refresh_tokens WHERE token_hash = $1",
+				"args": []interface{}{"abc"},
+			},
+			map[string]interface{}{
+				"sql":  "SELECT user_id FROM refresh_tokens WHERE token_hash = $1",
+				"args": redact.Placeholder,
+			},
+		},
+		{
+			"other statements",
+			map[string]interface{}{
+				"sql":  "SELECT id, title FROM posts WHERE id = $1",
+				"args": []interface{}{1},
+			},
+			map[string]interface{}{
+				"sql":  "SELECT id, title FROM posts WHERE id = $1",
+				"args": []interface{}{1},
+			},
+		},
+		{
+			"no args",
+			map[string]interface{}{"sql": "SELECT password FROM users"},
+			map[string]interface{}{"sql": "SELECT password FROM users"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recordingLogger{}
+			original := copyData(tt.data)
+			redactingLogger{rec}.Log(context.Background(), pgx.LogLevelInfo, "Query", tt.data)
+			if !reflect.DeepEqual(rec.data, tt.want) {
+				t.Errorf("logged %v, want %v", rec.data, tt.want)
+			}
+			if !reflect.DeepEqual(tt.data, original) {
+				t.Errorf("data of pgx is changed to %v", tt.data)
+			}
+		})
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	ctx := auth.WithUserID(logctx.WithRequestID(context.Background(), "req-1"), 7)
+	rec := &recordingLogger{}
+	requestLogger{rec}.Log(ctx, pgx.LogLevelInfo, "Query", map[string]interface{}{"sql": "SELECT 1"})
+	want := map[string]interface{}{"sql": "SELECT 1", "request_id": "req-1", "user_id": 7}
+	if !reflect.DeepEqual(rec.data, want) {
+		t.Errorf("logged %v, want %v", rec.data, want)
+	}
+}
+
+func copyData(data map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		res[k] = v
+	}
+	return res
+}
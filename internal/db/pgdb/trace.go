@@ -0,0 +1,89 @@
+package pgdb
+
+import (
+	"context"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"time"
+)
+
+// TracerName is the instrumentation name of statement spans
+const TracerName = "github.com/ptsypyshev/simple-blog/internal/db/pgdb"
+
+// tracingLogger makes a span of every statement pgx logs when it is done.
+// pgx v4 has no tracing hooks, but the log entry carries the context,
+// the statement and its duration, so the span is started back in time.
+type tracingLogger struct {
+	pgx.Logger
+}
+
+func (l tracingLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	if sql, ok := data["sql"].(string); ok {
+		traceStatement(ctx, msg, sql, data)
+	} else if msg == "SendBatch" {
+		traceStatement(ctx, msg, "", data)
+	}
+	l.Logger.Log(ctx, level, msg, data)
+}
+
+func traceStatement(ctx context.Context, msg, sql string, data map[string]interface{}) {
+	end := time.Now()
+	start := end
+	if d, ok := data["time"].(time.Duration); ok {
+		start = end.Add(-d)
+	}
+	op := operation(sql)
+	if op == "" {
+		op = msg
+	}
+	_, span := otel.Tracer(TracerName).Start(ctx, op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start),
+	)
+	defer span.End(trace.WithTimestamp(end))
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperationKey.String(op),
+	)
+	if sql != "" {
+		// Arguments are left out, they may carry credentials
+		span.SetAttributes(semconv.DBStatementKey.String(strings.TrimSpace(sql)))
+	}
+	switch v := data["rowCount"].(type) {
+	case int:
+		span.SetAttributes(attribute.Int("db.rows", v))
+	case int64:
+		span.SetAttributes(attribute.Int64("db.rows", v))
+	}
+	if tag, ok := data["commandTag"].(pgconn.CommandTag); ok {
+		span.SetAttributes(attribute.Int64("db.rows", tag.RowsAffected()))
+	}
+	if err, ok := data["err"].(error); ok && err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// operation returns the first keyword of a statement, e.g. SELECT or WITH
+func operation(sql string) string {
+	for _, line := range strings.Split(sql, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "--") {
+			continue
+		}
+		if i := strings.IndexFunc(line, func(r rune) bool { return r == ' ' || r == '(' || r == ';' }); i >= 0 {
+			line = line[:i]
+		}
+		return strings.ToUpper(line)
+	}
+	return ""
+}
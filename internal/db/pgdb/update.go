@@ -0,0 +1,197 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/auth"
+	"reflect"
+	"strings"
+)
+
+var (
+	ErrNoFields     = errors.New("no fields to update")
+	ErrUnknownField = errors.New("unknown field")
+)
+
+type setClause struct {
+	column string
+	expr   string
+	value  interface{}
+}
+
+// Update builds a parameterized UPDATE statement for a single row identified by id.
+// Values are never formatted into the query, they are passed as $n arguments.
+type Update struct {
+	table   string
+	id      interface{}
+	sets    []setClause
+	stamped bool
+	actor   interface{}
+}
+
+func NewUpdate(table string, id interface{}) *Update {
+	return &Update{
+		table: table,
+		id:    id,
+	}
+}
+
+// Set adds "column = $n" to the statement.
+func (u *Update) Set(column string, value interface{}) *Update {
+	return u.SetExpr(column, "%s", value)
+}
+
+// SetExpr adds "column = expr" where %s in expr is replaced with the value placeholder,
+// e.g. SetExpr("password", "crypt(%s, gen_salt('bf', 8))", password).
+func (u *Update) SetExpr(column, expr string, value interface{}) *Update {
+	for i := range u.sets {
+		if u.sets[i].column == column {
+			u.sets[i].expr = expr
+			u.sets[i].value = value
+			return u
+		}
+	}
+	u.sets = append(u.sets, setClause{column: column, expr: expr, value: value})
+	return u
+}
+
+// Wrap replaces the expression of an already added column and does nothing otherwise.
+func (u *Update) Wrap(column, expr string) *Update {
+	for i := range u.sets {
+		if u.sets[i].column == column {
+			u.sets[i].expr = expr
+		}
+	}
+	return u
+}
+
+// Stamp sets updated_at to the current time and updated_by to the user of ctx
+// (NULL for system changes). Stamps alone are not enough for a statement.
+func (u *Update) Stamp(ctx context.Context) *Update {
+	u.stamped = true
+	u.actor = ActorID(ctx)
+	return u
+}
+
+func (u *Update) Has(column string) bool {
+	for _, s := range u.sets {
+		if s.column == column {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *Update) Len() int {
+	return len(u.sets)
+}
+
+// Query returns the statement and its arguments. The id is always the last argument.
+func (u *Update) Query() (string, []interface{}, error) {
+	if len(u.sets) == 0 {
+		return "", nil, ErrNoFields
+	}
+	sets := make([]string, 0, len(u.sets))
+	args := make([]interface{}, 0, len(u.sets)+1)
+	for _, s := range u.sets {
+		args = append(args, s.value)
+		placeholder := fmt.Sprintf("$%d", len(args))
+		sets = append(sets, fmt.Sprintf("%s = %s", s.column, strings.ReplaceAll(s.expr, "%s", placeholder)))
+	}
+	if u.stamped {
+		args = append(args, u.actor)
+		sets = append(sets, fmt.Sprintf("updated_at = NOW(), updated_by = $%d", len(args)))
+	}
+	args = append(args, u.id)
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d;", u.table, strings.Join(sets, ", "), len(args))
+	return query, args, nil
+}
+
+// UpdateFromStruct builds an Update from a model. Columns are taken from the db tag
+// or, if there is none, from the json tag. Fields tagged db:"-" are never updated.
+// The "id" column identifies the row.
+//
+// Fields tagged db:"name,readonly" are maintained by stores, they are skipped even if masked.
+//
+// If mask is empty only non-zero fields are updated. Otherwise exactly the masked
+// fields are updated, so they can be set to zero values (false, "", 0).
+func UpdateFromStruct(table string, obj interface{}, mask []string) (*Update, error) {
+	v := reflect.Indirect(reflect.ValueOf(obj))
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot build update from %s", v.Kind())
+	}
+	columns := structColumns(v.Type())
+	idx, ok := columns["id"]
+	if !ok {
+		return nil, errors.New("no id specified")
+	}
+	upd := NewUpdate(table, v.Field(idx).Interface())
+
+	if len(mask) == 0 {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			column, ok := fieldColumn(t.Field(i))
+			if !ok || column == "id" || readOnly(t.Field(i)) || v.Field(i).IsZero() {
+				continue
+			}
+			upd.Set(column, v.Field(i).Interface())
+		}
+		return upd, nil
+	}
+
+	for _, column := range mask {
+		if column == "id" {
+			continue
+		}
+		i, ok := columns[column]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, column)
+		}
+		if readOnly(v.Type().Field(i)) {
+			continue
+		}
+		upd.Set(column, v.Field(i).Interface())
+	}
+	return upd, nil
+}
+
+func structColumns(t reflect.Type) map[string]int {
+	columns := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if column, ok := fieldColumn(t.Field(i)); ok {
+			columns[column] = i
+		}
+	}
+	return columns
+}
+
+func fieldColumn(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	if tag, ok := f.Tag.Lookup("db"); ok {
+		name := strings.Split(tag, ",")[0]
+		return name, name != "-" && name != ""
+	}
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	return name, name != "-" && name != ""
+}
+
+func readOnly(f reflect.StructField) bool {
+	opts := strings.Split(f.Tag.Get("db"), ",")[1:]
+	for _, o := range opts {
+		if o == "readonly" {
+			return true
+		}
+	}
+	return false
+}
+
+// ActorID returns the id of the current user as a query arg, nil if there is none.
+func ActorID(ctx context.Context) interface{} {
+	if id, ok := auth.UserID(ctx); ok {
+		return id
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"github.com/ptsypyshev/simple-blog/internal/auth"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpdateQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		build     func() *Update
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			"set",
+			func() *Update {
+				return NewUpdate("users", 7).Set("first_name", "Ivan").Set("is_active", false)
+			},
+			"UPDATE users SET first_name = $1, is_active = $2 WHERE id = $3;",
+			[]interface{}{"Ivan", false, 7},
+		},
+		{
+			"set expr",
+			func() *Update {
+				return NewUpdate("users", 7).Set("email", "a@b.c").SetExpr("password", "crypt(%s, gen_salt('bf', 8))", "secret")
+			},
+			"UPDATE users SET email = $1, password = crypt($2, gen_salt('bf', 8)) WHERE id = $3;",
+			[]interface{}{"a@b.c", "secret", 7},
+		},
+		{
+			"set again replaces",
+			func() *Update {
+				return NewUpdate("posts", 1).Set("title", "a").Set("body", "b").Set("title", "c")
+			},
+			"UPDATE posts SET title = $1, body = $2 WHERE id = $3;",
+			[]interface{}{"c", "b", 1},
+		},
+		{
+			"wrap",
+			func() *Update {
+				return NewUpdate("posts", 1).Set("status", "draft").Set("published_at", nil).
+					Wrap("published_at", "COALESCE(%s, NOW())")
+			},
+			"UPDATE posts SET status = $1, published_at = COALESCE($2, NOW()) WHERE id = $3;",
+			[]interface{}{"draft", nil, 1},
+		},
+		{
+			"wrap of a missing column",
+			func() *Update {
+				return NewUpdate("posts", 1).Set("title", "a").Wrap("body", "lower(%s)")
+			},
+			"UPDATE posts SET title = $1 WHERE id = $2;",
+			[]interface{}{"a", 1},
+		},
+		{
+			"stamp",
+			func() *Update {
+				ctx := auth.WithUserID(context.Background(), 3)
+				return NewUpdate("tags", 5).Set("name", "go").Stamp(ctx)
+			},
+			"UPDATE tags SET name = $1, updated_at = NOW(), updated_by = $2 WHERE id = $3;",
+			[]interface{}{"go", 3, 5},
+		},
+		{
+			"stamp of the system",
+			func() *Update {
+				return NewUpdate("tags", 5).Set("name", "go").Stamp(context.Background())
+			},
+			"UPDATE tags SET name = $1, updated_at = NOW(), updated_by = $2 WHERE id = $3;",
+			[]interface{}{"go", nil, 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := tt.build().Query()
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if query != tt.wantQuery {
+				t.Errorf("query = %q, want %q", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestUpdateQueryNoFields(t *testing.T) {
+	tests := []struct {
+		name string
+		upd  *Update
+	}{
+		{"empty", NewUpdate("posts", 1)},
+		{"stamp only", NewUpdate("posts", 1).Stamp(context.Background())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := tt.upd.Query(); !errors.Is(err, ErrNoFields) {
+				t.Errorf("Query() error = %v, want %v", err, ErrNoFields)
+			}
+		})
+	}
+}
+
+func TestUpdateFromStruct(t *testing.T) {
+	tests := []struct {
+		name      string
+		table     string
+		obj       interface{}
+		mask      []string
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			"non-zero fields without a mask",
+			"users",
+			models.User{Id: 2, FirstName: "Ivan", Email: "i@e.loc"},
+			nil,
+			"UPDATE users SET first_name = $1, email = $2 WHERE id = $3;",
+			[]interface{}{"Ivan", "i@e.loc", 2},
+		},
+		{
+			"mask writes zero values",
+			"users",
+			models.User{Id: 2},
+			[]string{"last_name", "is_active"},
+			"UPDATE users SET last_name = $1, is_active = $2 WHERE id = $3;",
+			[]interface{}{"", false, 2},
+		},
+		{
+			"mask skips the id",
+			"users",
+			models.User{Id: 2, LastName: "Ivanov"},
+			[]string{"id", "last_name"},
+			"UPDATE users SET last_name = $1 WHERE id = $2;",
+			[]interface{}{"Ivanov", 2},
+		},
+		{
+			"db tag names the column",
+			"comments",
+			models.Comment{Id: 4, Body: "hi", BodyHTML: "<p>hi</p>"},
+			[]string{"body", "body_html"},
+			"UPDATE comments SET body = $1, body_html = $2 WHERE id = $3;",
+			[]interface{}{"hi", "<p>hi</p>", 4},
+		},
+		{
+			"readonly columns are skipped with a mask",
+			"comments",
+			models.Comment{Id: 4, Body: "hi", PostId: 9, ParentId: 3, Depth: 1, Status: models.CommentApproved, UpdatedBy: 1},
+			[]string{"body", "post_id", "parent_id", "depth", "status", "updated_by"},
+			"UPDATE comments SET body = $1 WHERE id = $2;",
+			[]interface{}{"hi", 4},
+		},
+		{
+			"readonly columns are skipped without a mask",
+			"comments",
+			models.Comment{Id: 4, Body: "hi", PostId: 9, Status: models.CommentApproved},
+			nil,
+			"UPDATE comments SET body = $1 WHERE id = $2;",
+			[]interface{}{"hi", 4},
+		},
+		{
+			"db:\"-\" fields are skipped without a mask",
+			"posts",
+			models.Post{Id: 1, Title: "Title", Slug: "title", Tags: []string{"go"}},
+			nil,
+			"UPDATE posts SET title = $1 WHERE id = $2;",
+			[]interface{}{"Title", 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upd, err := UpdateFromStruct(tt.table, tt.obj, tt.mask)
+			if err != nil {
+				t.Fatalf("UpdateFromStruct() error = %v", err)
+			}
+			query, args, err := upd.Query()
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if query != tt.wantQuery {
+				t.Errorf("query = %q, want %q", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestUpdateFromStructErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		obj     interface{}
+		mask    []string
+		wantErr error
+	}{
+		{"unknown field", models.User{Id: 1}, []string{"nickname"}, ErrUnknownField},
+		{"db:\"-\" field in the mask", models.Post{Id: 1}, []string{"slug"}, ErrUnknownField},
+		{"json:\"-\" name is not a column", models.User{Id: 1}, []string{"-"}, ErrUnknownField},
+		{"readonly fields only", models.Comment{Id: 1, Status: models.CommentApproved}, []string{"status", "post_id"}, ErrNoFields},
+		{"zero struct without a mask", models.User{Id: 1}, nil, ErrNoFields},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upd, err := UpdateFromStruct("t", tt.obj, tt.mask)
+			if err == nil {
+				_, _, err = upd.Query()
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestUpdateFromStructInjection checks that mask entries only pick columns of the model,
+// so nothing a client sends in ?fields= gets into SQL.
+func TestUpdateFromStructInjection(t *testing.T) {
+	masks := [][]string{
+		{"first_name = 'x', role = 'admin' --"},
+		{"first_name; DROP TABLE users"},
+		{`"role"`},
+		{"Role"},
+		{"FirstName"},
+	}
+	for _, mask := range masks {
+		t.Run(mask[0], func(t *testing.T) {
+			upd, err := UpdateFromStruct("users", models.User{Id: 1, FirstName: "x"}, mask)
+			if !errors.Is(err, ErrUnknownField) {
+				t.Fatalf("error = %v, want %v", err, ErrUnknownField)
+			}
+			if upd != nil {
+				t.Errorf("update is built: %+v", upd)
+			}
+		})
+	}
+
+	// Values never get into the query, even when they look like SQL
+	upd, err := UpdateFromStruct("users", models.User{Id: 1, FirstName: "x', role = 'admin"}, []string{"first_name"})
+	if err != nil {
+		t.Fatalf("UpdateFromStruct() error = %v", err)
+	}
+	query, _, err := upd.Query()
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if strings.Contains(query, "admin") {
+		t.Errorf("value is in the query: %s", query)
+	}
+}
+
+func TestUpdateFromStructNotStruct(t *testing.T) {
+	if _, err := UpdateFromStruct("users", 1, nil); err == nil {
+		t.Error("error = nil for a non-struct")
+	}
+	if _, err := UpdateFromStruct("users", struct{ Name string }{"x"}, nil); err == nil {
+		t.Error("error = nil for a struct without id")
+	}
+}
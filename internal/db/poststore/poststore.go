@@ -2,77 +2,178 @@ package poststore
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
-	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/log"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
 	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
 	"github.com/ptsypyshev/simple-blog/internal/models"
 	"github.com/ptsypyshev/simple-blog/internal/repositories/postrepo"
+	"github.com/ptsypyshev/simple-blog/internal/slug"
 	"go.uber.org/zap"
 	"strconv"
+	"strings"
 )
 
 const (
+	// PostTags selects slugs of the post tags as an array
+	PostTags    = `ARRAY(SELECT t.slug FROM post_tags pt JOIN tags t ON t.id = pt.tag_id WHERE pt.post_id = posts.id ORDER BY t.slug)`
+	PostColumns = `id, title, slug, body, body_html, COALESCE(user_id, 0), status, published_at, COALESCE(category_id, 0), moderate_comments, ` + PostTags + `,
+    created_at, updated_at, COALESCE(updated_by, 0)`
 	PostCreate = `
-INSERT INTO posts(title, body, user_id)
+INSERT INTO posts(title, slug, body, body_html, user_id, status, published_at, category_id, moderate_comments, updated_by)
 VALUES
-    ($1, $2, $3)
+    ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9, $10)
 RETURNING id;
 `
-	PostSelectByID = `SELECT * FROM posts WHERE id = $1;`
+	PostSelectByID = `SELECT ` + PostColumns + ` FROM posts WHERE id = $1;`
+	// PostSelectBySlug finds a post by its current or an old slug
+	PostSelectBySlug = `SELECT ` + PostColumns + ` FROM posts
+WHERE id = COALESCE((SELECT id FROM posts WHERE slug = $1), (SELECT post_id FROM post_slugs WHERE slug = $1));`
 	PostDeleteByID = `
 DELETE FROM posts WHERE id = $1;
 `
+	// PostSelectExpanded reads a post with its author and first comments in one round trip,
+	// related rows are aggregated into JSON and skipped unless requested ($2, $3).
+	PostSelectExpanded = `
+SELECT p.id, p.title, p.slug, p.body, p.body_html, COALESCE(p.user_id, 0), p.status, p.published_at, COALESCE(p.category_id, 0), p.moderate_comments,
+    ARRAY(SELECT t.slug FROM post_tags pt JOIN tags t ON t.id = pt.tag_id WHERE pt.post_id = p.id ORDER BY t.slug),
+    p.created_at, p.updated_at, COALESCE(p.updated_by, 0),
+    CASE WHEN $2 THEN (
+        SELECT json_build_object(
+            'id', u.id, 'username', u.username, 'first_name', u.first_name, 'last_name', u.last_name,
+            'email', u.email, 'is_active', u.is_active, 'role', u.role,
+            'created_at', u.created_at, 'updated_at', u.updated_at, 'updated_by', COALESCE(u.updated_by, 0)
+        ) FROM users u WHERE u.id = p.user_id
+    ) END,
+    CASE WHEN $3 THEN (
+        SELECT COALESCE(json_agg(json_build_object(
+            'id', c.id, 'body', c.body, 'body_html', c.body_html, 'user_id', COALESCE(c.user_id, 0), 'post_id', c.post_id,
+            'parent_id', COALESCE(c.parent_id, 0), 'depth', c.depth, 'deleted_at', c.deleted_at, 'status', c.status,
+            'created_at', c.created_at, 'updated_at', c.updated_at, 'updated_by', COALESCE(c.updated_by, 0)
+        ) ORDER BY c.id), '[]')
+        FROM (SELECT * FROM comments WHERE post_id = p.id AND status = 'approved' ORDER BY id LIMIT $4) c
+    ) END
+FROM posts p WHERE p.id = $1;
+`
+	// PostPublishDue publishes due posts, their revisions are added with PostRevisionInsert
+	PostPublishDue = `
+UPDATE posts SET status = 'published', updated_at = NOW(), updated_by = NULL
+WHERE status = 'scheduled' AND published_at <= NOW()
+RETURNING id;
+`
+	PostUserExists = `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1);`
+	PostTagID      = `SELECT id FROM tags WHERE slug = $1;`
+	PostCategoryID = `SELECT id FROM categories WHERE slug = $1;`
+	// PostTouch stamps a post whose related rows have changed
+	PostTouch = `UPDATE posts SET updated_at = NOW(), updated_by = $2 WHERE id = $1;`
+	// TagsUpsert creates missing tags of names $1 and slugs $2
+	TagsUpsert = `
+INSERT INTO tags(name, slug, updated_by)
+SELECT name, slug, $3 FROM unnest($1::text[], $2::text[]) AS t(name, slug)
+ON CONFLICT (slug) DO NOTHING;
+`
+	PostTagsDelete = `DELETE FROM post_tags WHERE post_id = $1;`
+	PostTagsInsert = `INSERT INTO post_tags(post_id, tag_id) SELECT $1, id FROM tags WHERE slug = ANY($2);`
+	// PostSlugsTaken selects slugs like $1 or $1-N used by posts other than $2, old slugs included
+	PostSlugsTaken = `
+SELECT slug FROM posts WHERE id <> $2 AND (slug = $1 OR slug LIKE $1 || '-%')
+UNION
+SELECT slug FROM post_slugs WHERE post_id <> $2 AND (slug = $1 OR slug LIKE $1 || '-%');
+`
+	// PostLock locks a post for an update, its status is checked against the one the change is made for
+	PostLock        = `SELECT slug, title, status FROM posts WHERE id = $1 FOR UPDATE;`
+	PostSlugUpdate  = `UPDATE posts SET slug = $2, updated_at = NOW(), updated_by = $3 WHERE id = $1;`
+	PostSlugArchive = `
+INSERT INTO post_slugs(slug, post_id) VALUES ($1, $2)
+ON CONFLICT (slug) DO UPDATE SET post_id = EXCLUDED.post_id, created_at = NOW();
+`
+	PostSlugRelease = `DELETE FROM post_slugs WHERE slug = $1;`
 )
 
 var _ postrepo.PostStorage = &PostsDB{}
 
+var postList = pgdb.List{
+	Table:   "posts",
+	Columns: PostColumns,
+	Sorts: map[string]pgdb.SortField{
+		"id":         {Column: "id", Type: "int"},
+		"title":      {Column: "title", Type: "text"},
+		"created_at": {Column: "created_at", Type: "timestamptz"},
+		"updated_at": {Column: "updated_at", Type: "timestamptz"},
+	},
+	DefaultSort: "id",
+	Filters: map[string]string{
+		"user_id": "user_id",
+		"tag_id":  "id IN (SELECT post_id FROM post_tags WHERE tag_id = %s)",
+		// Posts of subcategories belong to the category too
+		"category_id": `category_id IN (
+    WITH RECURSIVE sub AS (
+        SELECT id FROM categories WHERE id = %s
+        UNION ALL
+        SELECT c.id FROM categories c JOIN sub ON c.parent_id = sub.id
+    ) SELECT id FROM sub)`,
+	},
+	Scope: func(p models.ListParams, arg func(interface{}) string) string {
+		switch {
+		case p.ViewAll:
+			return ""
+		case p.ViewerId != 0:
+			return fmt.Sprintf("(status IN ('published', 'archived') OR user_id = %s)", arg(p.ViewerId))
+		}
+		return "status IN ('published', 'archived')"
+	},
+}
+
 type PostsDB struct {
 	pool   *pgxpool.Pool
 	logger *zap.Logger
-	tracer opentracing.Tracer
 }
 
-func NewPostsDB(p *pgxpool.Pool, l *zap.Logger, t opentracing.Tracer) *PostsDB {
+func NewPostsDB(p *pgxpool.Pool, l *zap.Logger) *PostsDB {
 	return &PostsDB{
 		pool:   p,
 		logger: l,
-		tracer: t,
 	}
 }
 
 func (db *PostsDB) Create(ctx context.Context, post models.Post) (int, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, db.tracer,
-		"PostStore.Create")
-	defer span.Finish()
-	span.LogFields(
-		log.String("query", PostCreate),
-		log.String("arg0", post.String()),
-	)
 	var id int
-	res := db.pool.QueryRow(
-		ctx, PostCreate, post.Title, post.Body, post.UserId,
-	)
-	err := res.Scan(&id)
+	// The post, its tags and its first revision are created together
+	err := db.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var err error
+		if post.Slug == "" {
+			post.Slug, err = uniqueSlug(ctx, tx, post.Title, 0)
+		} else {
+			// A given slug is taken even if it is an old slug of another post
+			_, err = tx.Exec(ctx, PostSlugRelease, post.Slug)
+		}
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(
+			ctx, PostCreate, post.Title, post.Slug, post.Body, post.BodyHTML, post.UserId, post.Status, post.PublishedAt, post.CategoryId, post.ModerateComments, pgdb.ActorID(ctx),
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+		if post.Tags != nil {
+			if err := setTags(ctx, tx, id, post.Tags); err != nil {
+				return err
+			}
+		}
+		return addRevision(ctx, tx, id)
+	})
 	if err != nil {
-		span.LogFields(log.Error(err))
+		err = pgdb.TranslateError(err)
 		return 0, err
 	}
-	span.LogFields(
-		log.String("Post result", post.String()),
-	)
 	return id, nil
 }
 
 func (db *PostsDB) Read(ctx context.Context, id int) (*models.Post, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, db.tracer,
-		"PostStore.Read")
-	defer span.Finish()
-	span.LogFields(
-		log.String("query", PostSelectByID),
-		log.String("arg0", strconv.Itoa(id)),
-	)
 	rows, _ := db.pool.Query(ctx, PostSelectByID, id)
 	var (
 		post  models.Post
@@ -81,81 +182,388 @@ func (db *PostsDB) Read(ctx context.Context, id int) (*models.Post, error) {
 	for rows.Next() {
 		if found {
 			err := fmt.Errorf("%w: post id %d", pgdb.ErrMultipleFound, id)
-			span.LogFields(log.Error(err))
 			return nil, err
 		}
-		if err := rows.Scan(&post.Id, &post.Title, &post.Body, &post.UserId); err != nil {
-			span.LogFields(log.Error(err))
+		if err := rows.Scan(&post.Id, &post.Title, &post.Slug, &post.Body, &post.BodyHTML, &post.UserId, &post.Status, &post.PublishedAt, &post.CategoryId, &post.ModerateComments, &post.Tags, &post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy); err != nil {
+			err = pgdb.TranslateError(err)
 			return nil, err
 		}
 		found = true
 	}
 	if err := rows.Err(); err != nil {
-		span.LogFields(log.Error(err))
+		err = pgdb.TranslateError(err)
 		return nil, err
 	}
 	if !found {
 		err := fmt.Errorf("%w: post id %d", pgdb.ErrNotFound, id)
-		span.LogFields(log.Error(err))
 		return nil, err
 	}
-	span.LogFields(
-		log.String("Post result", post.String()),
+	return &post, nil
+}
+
+// ReadBySlug returns a post by its current or an old slug, the caller compares them
+// to redirect from old ones.
+func (db *PostsDB) ReadBySlug(ctx context.Context, slug string) (*models.Post, error) {
+	var post models.Post
+	err := db.pool.QueryRow(ctx, PostSelectBySlug, slug).Scan(
+		&post.Id, &post.Title, &post.Slug, &post.Body, &post.BodyHTML, &post.UserId, &post.Status, &post.PublishedAt, &post.CategoryId, &post.ModerateComments, &post.Tags, &post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: post %s", pgdb.ErrNotFound, slug)
+	}
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
 	return &post, nil
 }
 
-func (db *PostsDB) Update(ctx context.Context, post models.Post) (*models.Post, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, db.tracer,
-		"PostStore.Update")
-	defer span.Finish()
-	UpdateQuery, err := pgdb.UpdateQueryCompilation("posts", post, models.Post{})
+// Update changes a post. A non-empty from is the status a status change was checked against,
+// the post is not updated and a conflict is returned when its status has changed since.
+func (db *PostsDB) Update(ctx context.Context, post models.Post, from string, fields ...string) (*models.Post, error) {
+	// Tags and the slug are not plain columns, they are set after the other fields
+	mask := len(fields) > 0
+	fields, tagsSet := without(fields, "tags")
+	fields, slugSet := without(fields, "slug")
+	tagsSet = tagsSet || post.Tags != nil
+	slugSet = slugSet || post.Slug != ""
+	titleSet := !mask && post.Title != ""
+	for _, f := range fields {
+		titleSet = titleSet || f == "title"
+	}
+	var (
+		UpdateQuery string
+		args        []interface{}
+	)
+	if !mask || len(fields) > 0 {
+		upd, err := pgdb.UpdateFromStruct("posts", post, fields)
+		if err == nil {
+			upd.Wrap("category_id", "NULLIF(%s, 0)")
+			upd.Stamp(ctx)
+			UpdateQuery, args, err = upd.Query()
+		}
+		if err != nil && !((tagsSet || slugSet) && errors.Is(err, pgdb.ErrNoFields)) {
+			err = fmt.Errorf("cannot compile query: %w", err)
+			err = pgdb.TranslateError(err)
+			return &models.Post{}, err
+		}
+	}
+	err := db.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var oldSlug, oldTitle, status string
+		err := tx.QueryRow(ctx, PostLock, post.Id).Scan(&oldSlug, &oldTitle, &status)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: post id %d", pgdb.ErrNotFound, post.Id)
+		}
+		if err != nil {
+			return err
+		}
+		if from != "" && status != from {
+			return apperr.Conflict("status_changed", fmt.Sprintf("post status has changed from %s to %s", from, status)).
+				WithDetails("status", status)
+		}
+		if UpdateQuery != "" {
+			if _, err := tx.Exec(ctx, UpdateQuery, args...); err != nil {
+				return err
+			}
+		}
+		// A renamed post gets a new slug unless the slug is given
+		title := oldTitle
+		if titleSet {
+			title = post.Title
+		}
+		if slugSet || title != oldTitle {
+			if err := setSlug(ctx, tx, post.Id, post.Slug, title, oldSlug); err != nil {
+				return err
+			}
+		}
+		if tagsSet {
+			if err := setTags(ctx, tx, post.Id, post.Tags); err != nil {
+				return err
+			}
+		}
+		return addRevision(ctx, tx, post.Id)
+	})
 	if err != nil {
-		err = fmt.Errorf("cannot compile query: %w", err)
-		span.LogFields(log.Error(err))
+		err = pgdb.TranslateError(err)
 		return &models.Post{}, err
 	}
-	span.LogFields(
-		log.String("query", UpdateQuery),
-		log.String("arg0", post.String()),
+	// Only a part of fields may be updated, so return the actual row
+	return db.Read(ctx, post.Id)
+}
+
+func (db *PostsDB) Delete(ctx context.Context, id int) error {
+	res, err := db.pool.Exec(ctx, PostDeleteByID, id)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		err = fmt.Errorf("%w: post id %d", pgdb.ErrNotFound, id)
+		return err
+	}
+	return nil
+}
+
+// List returns a page of posts and its metadata.
+func (db *PostsDB) List(ctx context.Context, params models.ListParams) ([]models.Post, *models.Page, error) {
+	params.Limit = pgdb.NormalizeLimit(params.Limit)
+	query, args, err := postList.Query(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var (
+		posts = make([]models.Post, 0, params.Limit+1)
+		total int
 	)
-	res, err := db.pool.Exec(ctx, UpdateQuery)
+	for rows.Next() {
+		var post models.Post
+		if err := rows.Scan(&post.Id, &post.Title, &post.Slug, &post.Body, &post.BodyHTML, &post.UserId, &post.Status, &post.PublishedAt, &post.CategoryId, &post.ModerateComments, &post.Tags, &post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy, &total); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, nil, err
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	n, page, err := postList.Result(ctx, db.pool, params, len(posts), total, func(i int) interface{} { return posts[i] })
 	if err != nil {
-		span.LogFields(log.Error(err))
-		return &models.Post{}, err
+		return nil, nil, err
 	}
+	return posts[:n], page, nil
+}
 
-	if rowsAffected := res.RowsAffected(); rowsAffected != 1 {
-		err = fmt.Errorf("update post error: %d rows affected", rowsAffected)
-		span.LogFields(log.Error(err))
-		return &models.Post{}, err
+// ListByUser returns a page of posts of a user. Unlike List it fails with
+// pgdb.ErrNotFound if the user does not exist.
+func (db *PostsDB) ListByUser(ctx context.Context, userID int, params models.ListParams) ([]models.Post, *models.Page, error) {
+	params.Filters = withFilter(params.Filters, "user_id", userID)
+	posts, page, err := db.List(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	// An empty page is ambiguous, only then the user is looked up
+	if page.Total == 0 {
+		var exists bool
+		if err := db.pool.QueryRow(ctx, PostUserExists, userID).Scan(&exists); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, nil, err
+		}
+		if !exists {
+			err := fmt.Errorf("%w: user id %d", pgdb.ErrNotFound, userID)
+			return nil, nil, err
+		}
 	}
-	span.LogFields(
-		log.String("Post result", post.String()),
+	return posts, page, nil
+}
+
+// ReadExpanded returns a post with the requested related resources.
+func (db *PostsDB) ReadExpanded(ctx context.Context, id int, include models.PostInclude) (*models.PostExpanded, error) {
+	var (
+		post             models.PostExpanded
+		author, comments []byte
+	)
+	err := db.pool.QueryRow(ctx, PostSelectExpanded, id, include.Author, include.Comments, pgdb.NormalizeLimit(include.CommentsLimit)).Scan(
+		&post.Id, &post.Title, &post.Slug, &post.Body, &post.BodyHTML, &post.UserId, &post.Status, &post.PublishedAt, &post.CategoryId, &post.ModerateComments, &post.Tags, &post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy, &author, &comments,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: post id %d", pgdb.ErrNotFound, id)
+	}
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	if author != nil {
+		if err := json.Unmarshal(author, &post.Author); err != nil {
+			return nil, fmt.Errorf("cannot decode author: %w", err)
+		}
+	}
+	if comments != nil {
+		post.Comments = []models.Comment{}
+		if err := json.Unmarshal(comments, &post.Comments); err != nil {
+			return nil, fmt.Errorf("cannot decode comments: %w", err)
+		}
+	}
 	return &post, nil
 }
 
-func (db *PostsDB) Delete(ctx context.Context, id int) error {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, db.tracer,
-		"PostStore.Delete")
-	defer span.Finish()
-	span.LogFields(
-		log.String("query", PostDeleteByID),
-		log.String("arg0", strconv.Itoa(id)),
-	)
-	res, err := db.pool.Exec(ctx, PostDeleteByID, id)
+// PublishDue publishes scheduled posts whose time has come. The scheduler has no user,
+// so revisions of published posts have no author, as other changes made by the system.
+func (db *PostsDB) PublishDue(ctx context.Context) (int64, error) {
+	var published int64
+	err := db.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, PostPublishDue)
+		if err != nil {
+			return err
+		}
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := addRevision(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		published = int64(len(ids))
+		return nil
+	})
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return 0, err
+	}
+	return published, nil
+}
+
+// ListByTag returns a page of posts with a tag. It fails with pgdb.ErrNotFound
+// if there is no such tag.
+func (db *PostsDB) ListByTag(ctx context.Context, tag string, params models.ListParams) ([]models.Post, *models.Page, error) {
+	var tagID int
+	err := db.pool.QueryRow(ctx, PostTagID, tag).Scan(&tagID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: tag %s", pgdb.ErrNotFound, tag)
+	}
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	params.Filters = withFilter(params.Filters, "tag_id", tagID)
+	return db.List(ctx, params)
+}
+
+// ListByCategory returns a page of posts of a category and its subcategories.
+// It fails with pgdb.ErrNotFound if there is no such category.
+func (db *PostsDB) ListByCategory(ctx context.Context, category string, params models.ListParams) ([]models.Post, *models.Page, error) {
+	var categoryID int
+	err := db.pool.QueryRow(ctx, PostCategoryID, category).Scan(&categoryID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: category %s", pgdb.ErrNotFound, category)
+	}
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	params.Filters = withFilter(params.Filters, "category_id", categoryID)
+	return db.List(ctx, params)
+}
+
+// setTags replaces tags of a post within tx and stamps the post. Tags are names or slugs,
+// missing tags are created.
+func setTags(ctx context.Context, tx pgx.Tx, postID int, tags []string) error {
+	res, err := tx.Exec(ctx, PostTouch, postID, pgdb.ActorID(ctx))
 	if err != nil {
-		span.LogFields(log.Error(err))
 		return err
 	}
-	if rowsAffected := res.RowsAffected(); rowsAffected != 1 {
-		err = fmt.Errorf("delete post error: %d rows affected", rowsAffected)
-		span.LogFields(log.Error(err))
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("%w: post id %d", pgdb.ErrNotFound, postID)
+	}
+	names := make([]string, 0, len(tags))
+	slugs := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		s := slug.Make(tag)
+		if s == "" {
+			continue
+		}
+		names = append(names, strings.TrimSpace(tag))
+		slugs = append(slugs, s)
+	}
+	if _, err := tx.Exec(ctx, TagsUpsert, names, slugs, pgdb.ActorID(ctx)); err != nil {
 		return err
 	}
-	span.LogFields(
-		log.String("Deleted post with id", strconv.Itoa(id)),
-	)
-	return nil
+	if _, err := tx.Exec(ctx, PostTagsDelete, postID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, PostTagsInsert, postID, slugs)
+	return err
+}
+
+// setSlug changes the slug of a post within tx, the old slug is kept to redirect from it.
+// An empty slug is made of the title.
+func setSlug(ctx context.Context, tx pgx.Tx, postID int, s, title, old string) error {
+	if s == "" {
+		var err error
+		if s, err = uniqueSlug(ctx, tx, title, postID); err != nil {
+			return err
+		}
+	}
+	if s == old {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, PostSlugRelease, s); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, PostSlugUpdate, postID, s, pgdb.ActorID(ctx)); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, PostSlugArchive, old, postID)
+	return err
+}
+
+// uniqueSlug makes a slug of the title which no other post uses, not even as an old slug.
+// A number is added to a taken slug, e.g. "hello-2".
+func uniqueSlug(ctx context.Context, tx pgx.Tx, title string, postID int) (string, error) {
+	base := slug.Make(title)
+	if base == "" {
+		base = "post"
+	}
+	rows, err := tx.Query(ctx, PostSlugsTaken, base, postID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return "", err
+		}
+		taken[s] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	s := base
+	for n := 2; taken[s]; n++ {
+		s = base + "-" + strconv.Itoa(n)
+	}
+	return s, nil
+}
+
+// without removes a field which is not a plain column from fields and reports whether it was there
+func without(fields []string, name string) ([]string, bool) {
+	res := make([]string, 0, len(fields))
+	found := false
+	for _, f := range fields {
+		if f == name {
+			found = true
+			continue
+		}
+		res = append(res, f)
+	}
+	return res, found
+}
+
+// withFilter sets a filter of a nested list, it overrides the filter of the query
+func withFilter(filters map[string]int, name string, v int) map[string]int {
+	res := map[string]int{name: v}
+	for k, f := range filters {
+		if k != name {
+			res[k] = f
+		}
+	}
+	return res
 }
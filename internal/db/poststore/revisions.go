@@ -0,0 +1,98 @@
+package poststore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+)
+
+const (
+	// PostRevisionInsert adds the current state of post $1 as its next revision made by user $2.
+	// NULL user means the system, e.g. the scheduler publishing the post.
+	PostRevisionInsert = `
+INSERT INTO post_revisions(post_id, rev, title, slug, body, status, published_at, category_id, tags, created_by)
+SELECT id, COALESCE((SELECT max(rev) FROM post_revisions r WHERE r.post_id = posts.id), 0) + 1,
+    title, slug, body, status, published_at, category_id, ` + PostTags + `, $2
+FROM posts WHERE id = $1;
+`
+	PostRevisionColumns = `id, post_id, rev, title, slug, body, status, published_at, COALESCE(category_id, 0), tags,
+    created_at, COALESCE(created_by, 0)`
+	PostRevisionSelect = `SELECT ` + PostRevisionColumns + ` FROM post_revisions WHERE post_id = $1 AND rev = $2;`
+)
+
+var postRevisionList = pgdb.List{
+	Table:   "post_revisions",
+	Columns: PostRevisionColumns,
+	Sorts: map[string]pgdb.SortField{
+		"id":         {Column: "id", Type: "int"},
+		"rev":        {Column: "rev", Type: "int"},
+		"created_at": {Column: "created_at", Type: "timestamptz"},
+	},
+	DefaultSort: "rev",
+	Filters: map[string]string{
+		"post_id": "post_id",
+	},
+}
+
+// ListRevisions returns a page of revisions of a post, the post itself is not looked up.
+func (db *PostsDB) ListRevisions(ctx context.Context, postID int, params models.ListParams) ([]models.PostRevision, *models.Page, error) {
+	params.Limit = pgdb.NormalizeLimit(params.Limit)
+	params.Filters = map[string]int{"post_id": postID}
+	query, args, err := postRevisionList.Query(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var (
+		revisions = make([]models.PostRevision, 0, params.Limit+1)
+		total     int
+	)
+	for rows.Next() {
+		var r models.PostRevision
+		if err := rows.Scan(&r.Id, &r.PostId, &r.Rev, &r.Title, &r.Slug, &r.Body, &r.Status, &r.PublishedAt, &r.CategoryId, &r.Tags, &r.CreatedAt, &r.CreatedBy, &total); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	if err := rows.Err(); err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	n, page, err := postRevisionList.Result(ctx, db.pool, params, len(revisions), total, func(i int) interface{} { return revisions[i] })
+	if err != nil {
+		return nil, nil, err
+	}
+	return revisions[:n], page, nil
+}
+
+func (db *PostsDB) ReadRevision(ctx context.Context, postID, rev int) (*models.PostRevision, error) {
+	var r models.PostRevision
+	err := db.pool.QueryRow(ctx, PostRevisionSelect, postID, rev).Scan(
+		&r.Id, &r.PostId, &r.Rev, &r.Title, &r.Slug, &r.Body, &r.Status, &r.PublishedAt, &r.CategoryId, &r.Tags, &r.CreatedAt, &r.CreatedBy,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: post id %d revision %d", pgdb.ErrNotFound, postID, rev)
+	}
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return &r, nil
+}
+
+// addRevision appends the current state of a post to its history within tx,
+// so every committed write of a post has a revision. Its author is the current
+// user, there is none for writes of the system.
+func addRevision(ctx context.Context, tx pgx.Tx, postID int) error {
+	_, err := tx.Exec(ctx, PostRevisionInsert, postID, pgdb.ActorID(ctx))
+	return err
+}
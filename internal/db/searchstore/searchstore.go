@@ -0,0 +1,197 @@
+package searchstore
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/searchrepo"
+	"go.uber.org/zap"
+	"html"
+	"strings"
+)
+
+// Matches are marked with control characters by ts_headline, the rest of
+// the snippet is escaped before they are replaced with <mark> tags.
+const (
+	markStart = "\x02"
+	markStop  = "\x03"
+)
+
+const (
+	LanguageSelect = `SELECT language::text FROM search_settings FOR UPDATE;`
+	LanguageUpdate = `UPDATE search_settings SET language = $1::regconfig;`
+	PostsReindex   = `UPDATE posts SET search = posts_search_vector(title, body);`
+	// Comments are reindexed without touching their updated_at
+	CommentsReindex = `UPDATE comments SET search = comments_search_vector(body);`
+
+	HeadlineOptions = "StartSel=" + markStart + ", StopSel=" + markStop + ", MaxFragments=2, MaxWords=30, MinWords=10"
+
+	// SearchQuery ranks matching posts and comments, %s are the conditions of posts and comments.
+	// Snippets are built for the requested page only.
+	SearchQuery = `
+WITH q AS (SELECT websearch_to_tsquery(search_language(), $1) AS query)
+SELECT r.type, r.id, r.post_id, r.user_id, r.title,
+    ts_headline(search_language(), r.body, q.query, $2), r.rank, r.created_at, r.total
+FROM (
+    SELECT *, count(*) OVER () AS total FROM (
+        SELECT 'post' AS type, p.id, p.id AS post_id, COALESCE(p.user_id, 0) AS user_id, p.title, p.body,
+            ts_rank(p.search, q.query) AS rank, p.created_at
+        FROM posts p, q
+        WHERE p.search @@ q.query%s
+        UNION ALL
+        SELECT 'comment', c.id, c.post_id, COALESCE(c.user_id, 0), p.title, c.body,
+            ts_rank(c.search, q.query), c.created_at
+        FROM comments c JOIN posts p ON p.id = c.post_id, q
+        WHERE c.search @@ q.query%s
+    ) found
+    ORDER BY rank DESC, created_at DESC, type, id
+    LIMIT $3 OFFSET $4
+) r, q
+ORDER BY r.rank DESC, r.created_at DESC, r.type, r.id;
+`
+)
+
+var _ searchrepo.SearchStorage = &SearchDB{}
+
+type SearchDB struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+func NewSearchDB(p *pgxpool.Pool, l *zap.Logger) *SearchDB {
+	return &SearchDB{
+		pool:   p,
+		logger: l,
+	}
+}
+
+func (db *SearchDB) Search(ctx context.Context, params models.SearchParams) ([]models.SearchResult, *models.Page, error) {
+	params.Limit = pgdb.NormalizeLimit(params.Limit)
+	args := []interface{}{params.Query, HeadlineOptions, params.Limit + 1, params.Offset}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	// Posts of comments are checked too, comments of hidden posts are hidden
+	var posts, comments []string
+	// Tombstones of deleted comments are kept for their replies only,
+	// comments waiting for moderation or turned down are never found
+	comments = append(comments, "c.deleted_at IS NULL", "c.status = 'approved'")
+	switch params.Type {
+	case models.SearchPost:
+		comments = append(comments, "FALSE")
+	case models.SearchComment:
+		posts = append(posts, "FALSE")
+	}
+	if cond := postScope(params.ListParams, arg); cond != "" {
+		posts = append(posts, cond)
+		comments = append(comments, cond)
+	}
+	if params.UserId != 0 {
+		userID := arg(params.UserId)
+		posts = append(posts, "p.user_id = "+userID)
+		comments = append(comments, "c.user_id = "+userID)
+	}
+	if params.From != nil {
+		from := arg(*params.From)
+		posts = append(posts, "p.created_at >= "+from)
+		comments = append(comments, "c.created_at >= "+from)
+	}
+	if params.To != nil {
+		to := arg(*params.To)
+		posts = append(posts, "p.created_at < "+to)
+		comments = append(comments, "c.created_at < "+to)
+	}
+	query := fmt.Sprintf(SearchQuery, conditions(posts), conditions(comments))
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var (
+		results = make([]models.SearchResult, 0, params.Limit+1)
+		total   int
+	)
+	for rows.Next() {
+		var r models.SearchResult
+		if err := rows.Scan(&r.Type, &r.Id, &r.PostId, &r.UserId, &r.Title, &r.Snippet, &r.Rank, &r.CreatedAt, &total); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, nil, err
+		}
+		r.Snippet = highlight(r.Snippet)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	// One extra row is fetched to know whether there is a next page
+	more := len(results) > params.Limit
+	if more {
+		results = results[:params.Limit]
+	}
+	page := &models.Page{
+		Limit:   params.Limit,
+		Offset:  params.Offset,
+		Total:   total,
+		HasMore: more,
+	}
+	return results, page, nil
+}
+
+// SetLanguage switches the text search language and rebuilds the vectors of all posts
+// and comments if it has changed. It reports whether the vectors were rebuilt.
+func (db *SearchDB) SetLanguage(ctx context.Context, language string) (bool, error) {
+	var changed bool
+	err := db.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var current string
+		if err := tx.QueryRow(ctx, LanguageSelect).Scan(&current); err != nil {
+			return err
+		}
+		if current == language {
+			return nil
+		}
+		changed = true
+		if _, err := tx.Exec(ctx, LanguageUpdate, language); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, PostsReindex); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, CommentsReindex)
+		return err
+	})
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return false, err
+	}
+	return changed, nil
+}
+
+// postScope limits results to posts the viewer may see, like the post lists do
+func postScope(p models.ListParams, arg func(interface{}) string) string {
+	switch {
+	case p.ViewAll:
+		return ""
+	case p.ViewerId != 0:
+		return fmt.Sprintf("(p.status IN ('published', 'archived') OR p.user_id = %s)", arg(p.ViewerId))
+	}
+	return "p.status IN ('published', 'archived')"
+}
+
+func conditions(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " AND " + strings.Join(conds, " AND ")
+}
+
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, markStart, "<mark>")
+	return strings.ReplaceAll(snippet, markStop, "</mark>")
+}
@@ -0,0 +1,85 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/authrepo"
+	"go.uber.org/zap"
+)
+
+const (
+	SessionCreate = `
+INSERT INTO sessions(id, user_id, expires_at)
+VALUES
+    ($1, $2, $3)
+RETURNING created_at;
+`
+	SessionSelectByID = `
+SELECT user_id, created_at, expires_at FROM sessions WHERE id = $1 AND expires_at > NOW();
+`
+	SessionDeleteByID = `
+DELETE FROM sessions WHERE id = $1;
+`
+	SessionDeleteExpired = `
+DELETE FROM sessions WHERE expires_at <= NOW();
+`
+)
+
+var _ authrepo.SessionStorage = &SessionsDB{}
+
+type SessionsDB struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+func NewSessionsDB(p *pgxpool.Pool, l *zap.Logger) *SessionsDB {
+	return &SessionsDB{
+		pool:   p,
+		logger: l,
+	}
+}
+
+func (db *SessionsDB) Create(ctx context.Context, session models.Session) (*models.Session, error) {
+	err := db.pool.QueryRow(ctx, SessionCreate, session.Id, session.UserId, session.ExpiresAt).Scan(&session.CreatedAt)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Read returns a not expired session by id (hash of the token).
+func (db *SessionsDB) Read(ctx context.Context, id string) (*models.Session, error) {
+	session := models.Session{Id: id}
+	err := db.pool.QueryRow(ctx, SessionSelectByID, id).Scan(&session.UserId, &session.CreatedAt, &session.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: session", pgdb.ErrNotFound)
+	}
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (db *SessionsDB) Delete(ctx context.Context, id string) error {
+	if _, err := db.pool.Exec(ctx, SessionDeleteByID, id); err != nil {
+		err = pgdb.TranslateError(err)
+		return err
+	}
+	return nil
+}
+
+func (db *SessionsDB) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := db.pool.Exec(ctx, SessionDeleteExpired)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
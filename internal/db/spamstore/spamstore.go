@@ -0,0 +1,166 @@
+package spamstore
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/spamrepo"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	// SpamDuplicates compares bodies the way comments_body_md5_idx indexes them
+	SpamDuplicates = `
+SELECT count(*) FROM comments
+WHERE md5(lower(btrim(regexp_replace(body, '\s+', ' ', 'g')))) = md5(lower(btrim(regexp_replace($1, '\s+', ' ', 'g'))))
+    AND created_at >= $2 AND deleted_at IS NULL AND id <> $3;
+`
+	SpamTokensSelect = `SELECT token, spam, ham FROM spam_tokens WHERE token = ANY($1);`
+	SpamTrained      = `SELECT count(*) FILTER (WHERE spam), count(*) FILTER (WHERE NOT spam) FROM spam_training;`
+	// SpamTrainingClaim adds a row of a comment learned the first time, nothing is taken back
+	// for its empty tokens. Concurrent claims of the comment wait for the row to be committed.
+	SpamTrainingClaim = `
+INSERT INTO spam_training(comment_id, spam, tokens) VALUES ($1, $2, '{}')
+ON CONFLICT (comment_id) DO NOTHING
+RETURNING comment_id;
+`
+	SpamTrainingLock = `SELECT spam, tokens FROM spam_training WHERE comment_id = $1 FOR UPDATE;`
+	// SpamTokensAdd adds $2 spam and $3 ham comments to counts of tokens $1
+	SpamTokensAdd = `
+INSERT INTO spam_tokens(token, spam, ham)
+SELECT t, $2, $3 FROM unnest($1::TEXT[]) t
+ON CONFLICT (token) DO UPDATE SET spam = spam_tokens.spam + EXCLUDED.spam, ham = spam_tokens.ham + EXCLUDED.ham;
+`
+	SpamTrainingUpsert = `
+INSERT INTO spam_training(comment_id, spam, tokens) VALUES ($1, $2, $3)
+ON CONFLICT (comment_id) DO UPDATE SET spam = EXCLUDED.spam, tokens = EXCLUDED.tokens, created_at = NOW();
+`
+)
+
+var _ spamrepo.SpamStorage = &SpamDB{}
+
+type SpamDB struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+func NewSpamDB(p *pgxpool.Pool, l *zap.Logger) *SpamDB {
+	return &SpamDB{
+		pool:   p,
+		logger: l,
+	}
+}
+
+// Duplicates counts comments other than commentID with the same body created since
+// the time, case and whitespace are ignored.
+func (db *SpamDB) Duplicates(ctx context.Context, body string, since time.Time, commentID int) (int, error) {
+	var n int
+	if err := db.pool.QueryRow(ctx, SpamDuplicates, body, since, commentID).Scan(&n); err != nil {
+		err = pgdb.TranslateError(err)
+		return 0, err
+	}
+	return n, nil
+}
+
+// Tokens returns counts of the learned tokens, unknown ones are left out.
+func (db *SpamDB) Tokens(ctx context.Context, tokens []string) (map[string]spamrepo.TokenCount, error) {
+	rows, err := db.pool.Query(ctx, SpamTokensSelect, tokens)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]spamrepo.TokenCount, len(tokens))
+	for rows.Next() {
+		var (
+			token string
+			c     spamrepo.TokenCount
+		)
+		if err := rows.Scan(&token, &c.Spam, &c.Ham); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, err
+		}
+		counts[token] = c
+	}
+	if err := rows.Err(); err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return counts, nil
+}
+
+// Trained counts learned spam and ham comments.
+func (db *SpamDB) Trained(ctx context.Context) (spamrepo.TokenCount, error) {
+	var c spamrepo.TokenCount
+	if err := db.pool.QueryRow(ctx, SpamTrained).Scan(&c.Spam, &c.Ham); err != nil {
+		err = pgdb.TranslateError(err)
+		return c, err
+	}
+	return c, nil
+}
+
+// Learn adds tokens of a comment to spam or ham counts. Tokens learned for the comment
+// before are taken back, nothing changes if the comment was learned the same way.
+// The training row of the comment is claimed first, so concurrent decisions on it
+// are learned one after another.
+func (db *SpamDB) Learn(ctx context.Context, commentID int, tokens []string, spam bool) error {
+	err := db.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var (
+			wasSpam bool
+			learned []string
+		)
+		err := tx.QueryRow(ctx, SpamTrainingClaim, commentID, spam).Scan(&commentID)
+		switch {
+		case err == nil:
+		case !errors.Is(err, pgx.ErrNoRows):
+			return err
+		default:
+			if err := tx.QueryRow(ctx, SpamTrainingLock, commentID).Scan(&wasSpam, &learned); err != nil {
+				return err
+			}
+			if wasSpam == spam && sameTokens(learned, tokens) {
+				return nil
+			}
+			spamDelta, hamDelta := counts(wasSpam, -1)
+			if _, err := tx.Exec(ctx, SpamTokensAdd, learned, spamDelta, hamDelta); err != nil {
+				return err
+			}
+		}
+		spamDelta, hamDelta := counts(spam, 1)
+		if _, err := tx.Exec(ctx, SpamTokensAdd, tokens, spamDelta, hamDelta); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, SpamTrainingUpsert, commentID, spam, tokens)
+		return err
+	})
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return err
+	}
+	return nil
+}
+
+// counts returns deltas of spam and ham counts
+func counts(spam bool, n int) (int, int) {
+	if spam {
+		return n, 0
+	}
+	return 0, n
+}
+
+// sameTokens reports whether sorted tokens are equal, a comment edited since it was
+// learned has other tokens.
+func sameTokens(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
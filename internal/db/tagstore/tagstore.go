@@ -0,0 +1,182 @@
+package tagstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/tagrepo"
+	"go.uber.org/zap"
+)
+
+const (
+	// TagPostCount counts public posts with a tag
+	TagPostCount = `(SELECT count(*) FROM post_tags pt JOIN posts p ON p.id = pt.post_id
+    WHERE pt.tag_id = tags.id AND p.status IN ('published', 'archived'))`
+	TagColumns = `id, name, slug, ` + TagPostCount + `, created_at, updated_at, COALESCE(updated_by, 0)`
+	TagCreate  = `
+INSERT INTO tags(name, slug, updated_by)
+VALUES
+    ($1, $2, $3)
+RETURNING id;
+`
+	TagSelectByID   = `SELECT ` + TagColumns + ` FROM tags WHERE id = $1;`
+	TagSelectBySlug = `SELECT ` + TagColumns + ` FROM tags WHERE slug = $1;`
+	TagDeleteByID   = `
+DELETE FROM tags WHERE id = $1;
+`
+)
+
+var _ tagrepo.TagStorage = &TagsDB{}
+
+var tagList = pgdb.List{
+	Table:   "tags",
+	Columns: TagColumns,
+	Sorts: map[string]pgdb.SortField{
+		"id":         {Column: "id", Type: "int"},
+		"name":       {Column: "name", Type: "text"},
+		"slug":       {Column: "slug", Type: "text"},
+		"post_count": {Column: TagPostCount, Type: "bigint"},
+	},
+	DefaultSort: "slug",
+}
+
+type TagsDB struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+func NewTagsDB(p *pgxpool.Pool, l *zap.Logger) *TagsDB {
+	return &TagsDB{
+		pool:   p,
+		logger: l,
+	}
+}
+
+func (db *TagsDB) Create(ctx context.Context, tag models.Tag) (int, error) {
+	var id int
+	res := db.pool.QueryRow(
+		ctx, TagCreate, tag.Name, tag.Slug, pgdb.ActorID(ctx),
+	)
+	err := res.Scan(&id)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return 0, err
+	}
+	return id, nil
+}
+
+func (db *TagsDB) Read(ctx context.Context, id int) (*models.Tag, error) {
+	tag, err := db.read(ctx, TagSelectByID, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: tag id %d", pgdb.ErrNotFound, id)
+	}
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return tag, nil
+}
+
+func (db *TagsDB) ReadBySlug(ctx context.Context, slug string) (*models.Tag, error) {
+	tag, err := db.read(ctx, TagSelectBySlug, slug)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: tag %s", pgdb.ErrNotFound, slug)
+	}
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return tag, nil
+}
+
+func (db *TagsDB) read(ctx context.Context, query string, arg interface{}) (*models.Tag, error) {
+	var tag models.Tag
+	err := db.pool.QueryRow(ctx, query, arg).Scan(
+		&tag.Id, &tag.Name, &tag.Slug, &tag.PostCount, &tag.CreatedAt, &tag.UpdatedAt, &tag.UpdatedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (db *TagsDB) Update(ctx context.Context, tag models.Tag, fields ...string) (*models.Tag, error) {
+	upd, err := pgdb.UpdateFromStruct("tags", tag, fields)
+	if err != nil {
+		err = fmt.Errorf("cannot compile query: %w", err)
+		err = pgdb.TranslateError(err)
+		return &models.Tag{}, err
+	}
+	upd.Stamp(ctx)
+	UpdateQuery, args, err := upd.Query()
+	if err != nil {
+		err = fmt.Errorf("cannot compile query: %w", err)
+		err = pgdb.TranslateError(err)
+		return &models.Tag{}, err
+	}
+	res, err := db.pool.Exec(ctx, UpdateQuery, args...)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return &models.Tag{}, err
+	}
+
+	if res.RowsAffected() == 0 {
+		err = fmt.Errorf("%w: tag id %d", pgdb.ErrNotFound, tag.Id)
+		return &models.Tag{}, err
+	}
+	// Only a part of fields may be updated, so return the actual row
+	return db.Read(ctx, tag.Id)
+}
+
+func (db *TagsDB) Delete(ctx context.Context, id int) error {
+	res, err := db.pool.Exec(ctx, TagDeleteByID, id)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		err = fmt.Errorf("%w: tag id %d", pgdb.ErrNotFound, id)
+		return err
+	}
+	return nil
+}
+
+// List returns a page of tags and its metadata.
+func (db *TagsDB) List(ctx context.Context, params models.ListParams) ([]models.Tag, *models.Page, error) {
+	params.Limit = pgdb.NormalizeLimit(params.Limit)
+	query, args, err := tagList.Query(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var (
+		tags  = make([]models.Tag, 0, params.Limit+1)
+		total int
+	)
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.Id, &tag.Name, &tag.Slug, &tag.PostCount, &tag.CreatedAt, &tag.UpdatedAt, &tag.UpdatedBy, &total); err != nil {
+			err = pgdb.TranslateError(err)
+			return nil, nil, err
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, nil, err
+	}
+	n, page, err := tagList.Result(ctx, db.pool, params, len(tags), total, func(i int) interface{} { return tags[i] })
+	if err != nil {
+		return nil, nil, err
+	}
+	return tags[:n], page, nil
+}
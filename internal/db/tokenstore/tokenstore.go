@@ -0,0 +1,102 @@
+package tokenstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/authrepo"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	RefreshTokenCreate = `
+INSERT INTO refresh_tokens(id, user_id, expires_at)
+VALUES
+    ($1, $2, $3)
+RETURNING created_at;
+`
+	RefreshTokenSelectByID = `
+SELECT user_id, created_at, expires_at, revoked_at FROM refresh_tokens WHERE id = $1;
+`
+	RefreshTokenRevoke = `
+UPDATE refresh_tokens SET revoked_at = NOW(), replaced_by = $2
+WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+RETURNING user_id;
+`
+	RefreshTokenRevokeByUser = `
+UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;
+`
+)
+
+var _ authrepo.RefreshTokenStorage = &RefreshTokensDB{}
+
+type RefreshTokensDB struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+func NewRefreshTokensDB(p *pgxpool.Pool, l *zap.Logger) *RefreshTokensDB {
+	return &RefreshTokensDB{
+		pool:   p,
+		logger: l,
+	}
+}
+
+func (db *RefreshTokensDB) Create(ctx context.Context, token models.RefreshToken) (*models.RefreshToken, error) {
+	err := db.pool.QueryRow(ctx, RefreshTokenCreate, token.Id, token.UserId, token.ExpiresAt).Scan(&token.CreatedAt)
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Read returns a token by id (hash of the token) including revoked and expired ones.
+func (db *RefreshTokensDB) Read(ctx context.Context, id string) (*models.RefreshToken, error) {
+	token := models.RefreshToken{Id: id}
+	err := db.pool.QueryRow(ctx, RefreshTokenSelectByID, id).Scan(
+		&token.UserId, &token.CreatedAt, &token.ExpiresAt, &token.RevokedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: refresh token", pgdb.ErrNotFound)
+	}
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Rotate revokes a valid token and creates the next one for the same user in one transaction.
+// It returns pgdb.ErrNotFound if the old token is unknown, expired or already revoked.
+func (db *RefreshTokensDB) Rotate(ctx context.Context, oldID, newID string, expiresAt time.Time) (*models.RefreshToken, error) {
+	next := models.RefreshToken{Id: newID, ExpiresAt: expiresAt}
+	err := db.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, RefreshTokenRevoke, oldID, newID).Scan(&next.UserId)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: refresh token", pgdb.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		return tx.QueryRow(ctx, RefreshTokenCreate, next.Id, next.UserId, next.ExpiresAt).Scan(&next.CreatedAt)
+	})
+	if err != nil {
+		err = pgdb.TranslateError(err)
+		return nil, err
+	}
+	return &next, nil
+}
+
+func (db *RefreshTokensDB) RevokeByUser(ctx context.Context, userID int) error {
+	if _, err := db.pool.Exec(ctx, RefreshTokenRevokeByUser, userID); err != nil {
+		err = pgdb.TranslateError(err)
+		return err
+	}
+	return nil
+}
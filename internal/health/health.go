@@ -0,0 +1,95 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Statuses of checks and reports
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDegraded = "degraded"
+)
+
+// Check is a dependency check. A failed optional check degrades the report
+// but the service stays ready.
+type Check struct {
+	Name     string
+	Optional bool
+	Run      func(ctx context.Context) error
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Optional   bool    `json:"optional,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// Report is the outcome of all checks
+type Report struct {
+	Status     string   `json:"status"`
+	DurationMs float64  `json:"duration_ms"`
+	Checks     []Result `json:"checks"`
+}
+
+// Ready reports whether no required check failed
+func (r Report) Ready() bool {
+	return r.Status != StatusFail
+}
+
+// Run runs checks concurrently, each one is limited by the timeout.
+// Results keep the order of checks.
+func Run(ctx context.Context, checks []Check, timeout time.Duration) Report {
+	start := time.Now()
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check, timeout)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, r := range results {
+		if r.Status != StatusFail {
+			continue
+		}
+		if !r.Optional {
+			report.Status = StatusFail
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	report.DurationMs = ms(time.Since(start))
+	return report
+}
+
+func run(ctx context.Context, check Check, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	err := check.Run(ctx)
+	res := Result{
+		Name:       check.Name,
+		Status:     StatusOK,
+		Optional:   check.Optional,
+		DurationMs: ms(time.Since(start)),
+	}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,46 @@
+package logctx
+
+import (
+	"context"
+	"github.com/ptsypyshev/simple-blog/internal/auth"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type ctxKey int
+
+const requestIDKey ctxKey = iota
+
+// WithRequestID returns a copy of ctx carrying the id of the current request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the id of the current request, empty outside of requests.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Fields returns the request id, the user id and the trace id of ctx as log fields.
+func Fields(ctx context.Context) []zap.Field {
+	var fields []zap.Field
+	if id := RequestID(ctx); id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+	if id, ok := auth.UserID(ctx); ok {
+		fields = append(fields, zap.Int("user_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+	}
+	return fields
+}
+
+// Logger returns l with fields of ctx, so all lines of one request can be followed.
+func Logger(ctx context.Context, l *zap.Logger) *zap.Logger {
+	if fields := Fields(ctx); len(fields) > 0 {
+		return l.With(fields...)
+	}
+	return l
+}
@@ -0,0 +1,117 @@
+// Package markup renders Markdown bodies of posts and comments to HTML which is safe to embed into pages.
+package markup
+
+import (
+	"bytes"
+	"fmt"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/ptsypyshev/simple-blog/internal/slug"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"regexp"
+	"strconv"
+)
+
+// HighlightStyle is the chroma style of assets/css/highlight.css
+const HighlightStyle = "github"
+
+var (
+	// Posts have highlighted code blocks and headings with anchors
+	posts = goldmark.New(
+		goldmark.WithExtensions(
+			extension.GFM,
+			highlighting.NewHighlighting(
+				highlighting.WithStyle(HighlightStyle),
+				highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+			),
+		),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+			parser.WithASTTransformers(util.Prioritized(anchors{}, 100)),
+		),
+	)
+	comments = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+	)
+
+	// policy is a whitelist, everything else (scripts, iframes, styles, event handlers) is stripped
+	policy = newPolicy()
+)
+
+// Post renders a post body.
+func Post(src string) (string, error) {
+	ctx := parser.NewContext(parser.WithIDs(headingIDs{}))
+	return render(posts, src, parser.WithContext(ctx))
+}
+
+// Comment renders a comment body.
+func Comment(src string) (string, error) {
+	return render(comments, src)
+}
+
+func render(md goldmark.Markdown, src string, opts ...parser.ParseOption) (string, error) {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(src), &buf, opts...); err != nil {
+		return "", fmt.Errorf("cannot render markdown: %w", err)
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}-]+$`)).
+		OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	// Highlighted code is styled with chroma classes
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-zA-Z0-9 _-]+$`)).
+		OnElements("a", "pre", "code", "span")
+	return p
+}
+
+// headingIDs makes heading ids of slugs, e.g. "Установка" becomes "ustanovka".
+// Repeated ids get a number.
+type headingIDs map[string]bool
+
+func (ids headingIDs) Generate(value []byte, _ ast.NodeKind) []byte {
+	base := slug.Make(string(value))
+	if base == "" {
+		base = "section"
+	}
+	id := base
+	for n := 1; ids[id]; n++ {
+		id = base + "-" + strconv.Itoa(n)
+	}
+	ids[id] = true
+	return []byte(id)
+}
+
+func (ids headingIDs) Put(value []byte) {
+	ids[string(value)] = true
+}
+
+// anchors adds a link to itself to every heading with an id
+type anchors struct{}
+
+func (anchors) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		id, ok := heading.AttributeString("id")
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+		link := ast.NewLink()
+		link.Destination = append([]byte("#"), id.([]byte)...)
+		link.SetAttributeString("class", []byte("anchor"))
+		link.AppendChild(link, ast.NewString([]byte("#")))
+		heading.AppendChild(heading, link)
+		return ast.WalkSkipChildren, nil
+	})
+}
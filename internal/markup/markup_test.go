@@ -0,0 +1,105 @@
+package markup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		unsafe  []string
+		keeping string
+	}{
+		{"script", "text <script>alert(1)</script>", []string{"<script"}, "text"},
+		{"iframe", "text <iframe src=\"https://evil.example\"></iframe>", []string{"<iframe", "evil.example"}, "text"},
+		{"event handler", "<img src=\"x.png\" onerror=\"alert(1)\"> <b onclick=\"alert(1)\">bold</b>", []string{"onerror=", "onclick="}, ""},
+		{"javascript link", "[click](javascript:alert(1))", []string{"javascript:", "alert(1)"}, "click"},
+		{"javascript link in html", "<a href=\"javascript:alert(1)\">click</a>", []string{"javascript:", "alert(1)"}, ""},
+		{"javascript autolink", "<javascript:alert(1)>", []string{"href=\"javascript:"}, ""},
+		{"style", "<style>body{display:none}</style>\n\ntext", []string{"<style", "display:none"}, "text"},
+		{"heading attributes", "## Title {onclick=\"alert(1)\"}", []string{"onclick=\""}, "Title"},
+	}
+	renderers := map[string]func(string) (string, error){"post": Post, "comment": Comment}
+	for _, tt := range tests {
+		for kind, render := range renderers {
+			t.Run(kind+" "+tt.name, func(t *testing.T) {
+				html, err := render(tt.src)
+				if err != nil {
+					t.Fatalf("render error = %v", err)
+				}
+				for _, s := range tt.unsafe {
+					if strings.Contains(html, s) {
+						t.Errorf("html carries %q: %s", s, html)
+					}
+				}
+				if !strings.Contains(html, tt.keeping) {
+					t.Errorf("html lost %q: %s", tt.keeping, html)
+				}
+			})
+		}
+	}
+}
+
+func TestPostHeadings(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			"anchor",
+			"## Install",
+			[]string{`<h2 id="install">Install<a href="#install" class="anchor"`},
+		},
+		{
+			"cyrillic",
+			"## Установка",
+			[]string{`id="ustanovka"`, `href="#ustanovka"`},
+		},
+		{
+			"repeated",
+			"## Usage\n\n## Usage",
+			[]string{`id="usage"`, `id="usage-1"`, `href="#usage-1"`},
+		},
+		{
+			"no letters",
+			"## !!!",
+			[]string{`id="section"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := Post(tt.src)
+			if err != nil {
+				t.Fatalf("Post() error = %v", err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(html, s) {
+					t.Errorf("html has no %q: %s", s, html)
+				}
+			}
+		})
+	}
+}
+
+func TestCommentHeadings(t *testing.T) {
+	html, err := Comment("## Install")
+	if err != nil {
+		t.Fatalf("Comment() error = %v", err)
+	}
+	if strings.Contains(html, "id=") || strings.Contains(html, "anchor") {
+		t.Errorf("comment heading has an anchor: %s", html)
+	}
+}
+
+func TestPostHighlighting(t *testing.T) {
+	html, err := Post("```go\nfunc main() {}\n```")
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	if !strings.Contains(html, `class="chroma"`) {
+		t.Errorf("code is not highlighted: %s", html)
+	}
+}
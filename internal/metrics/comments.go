@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// CountTimeout limits counting rows on a scrape
+const CountTimeout = 5 * time.Second
+
+// pendingCollector counts comments waiting for moderation on every scrape,
+// so the queue size is right no matter which instance moderated them
+type pendingCollector struct {
+	count   func(ctx context.Context) (int, error)
+	pending *prometheus.Desc
+}
+
+// NewPendingCollector returns a gauge of the moderation queue size, count is called on every scrape.
+func NewPendingCollector(count func(ctx context.Context) (int, error)) prometheus.Collector {
+	return &pendingCollector{
+		count: count,
+		pending: prometheus.NewDesc(prometheus.BuildFQName(Namespace, "", "comments_pending"),
+			"Comments waiting for moderation.", nil, nil),
+	}
+}
+
+func (c *pendingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.pending
+}
+
+func (c *pendingCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), CountTimeout)
+	defer cancel()
+	n, err := c.count(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.pending, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, float64(n))
+}
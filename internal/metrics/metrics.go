@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"time"
+)
+
+// Namespace prefixes names of all metrics of the blog
+const Namespace = "blog"
+
+// Results of repository operations
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+var (
+	// Registry holds all metrics served on /metrics
+	Registry = prometheus.NewRegistry()
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	RepoOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "repository",
+		Name:      "operations_total",
+		Help:      "Repository operations by repository, operation and result.",
+	}, []string{"repository", "operation", "result"})
+	RepoDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "repository",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of repository operations by repository and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"repository", "operation"})
+
+	PostsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "posts_created_total",
+		Help:      "Posts created.",
+	})
+	LoginsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "logins_failed_total",
+		Help:      "Logins with wrong credentials by method: session or token.",
+	}, []string{"method"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPDuration,
+		RepoOperations, RepoDuration,
+		PostsCreated, LoginsFailed,
+	)
+}
+
+// ObserveRepo counts an operation of a repository and its duration since start.
+// It is deferred with the address of the error result, e.g.
+//
+//	defer metrics.ObserveRepo("posts", "create", time.Now(), &err)
+func ObserveRepo(repo, op string, start time.Time, err *error) {
+	result := ResultOK
+	if err != nil && *err != nil {
+		result = ResultError
+	}
+	RepoOperations.WithLabelValues(repo, op, result).Inc()
+	RepoDuration.WithLabelValues(repo, op).Observe(time.Since(start).Seconds())
+}
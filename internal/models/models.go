@@ -5,42 +5,351 @@ import (
 	"time"
 )
 
+const (
+	RoleAdmin     = "admin"
+	RoleEditor    = "editor"
+	RoleAuthor    = "author"
+	RoleCommenter = "commenter"
+)
+
 type User struct {
-	Id        int    `json:"id"`
-	Username  string `json:"username"`
-	Password  string `json:"password"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Email     string `json:"email"`
-	IsActive  bool   `json:"is_active"`
+	Id        int       `json:"id"`
+	Username  string    `json:"username"`
+	Password  string    `json:"-" db:"password"` // write-only, see handlers DTOs
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	IsActive  bool      `json:"is_active"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at" db:"created_at,readonly"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at,readonly"`
+	// UpdatedBy is the id of the user who made the last change, 0 for system changes
+	UpdatedBy int `json:"updated_by" db:"updated_by,readonly"`
 }
 
+// Statuses of a post
+const (
+	PostDraft     = "draft"
+	PostScheduled = "scheduled"
+	PostPublished = "published"
+	PostArchived  = "archived"
+)
+
 type Post struct {
-	Id     int    `json:"id"`
-	Title  string `json:"title"`
-	Body   string `json:"body"`
-	UserId int    `json:"user_id"`
+	Id    int    `json:"id"`
+	Title string `json:"title"`
+	// Slug is made of the title unless it is given, old slugs of a post redirect to the current one
+	Slug string `json:"slug" db:"-"`
+	// Body is Markdown, BodyHTML is rendered of it and sanitized by the application
+	Body     string `json:"body"`
+	BodyHTML string `json:"body_html" db:"body_html"`
+	UserId   int    `json:"user_id"`
+	Status   string `json:"status"`
+	// PublishedAt is the time a scheduled post is going to be published at
+	PublishedAt *time.Time `json:"published_at"`
+	CategoryId  int        `json:"category_id"`
+	// ModerateComments overrides the global comment moderation setting, nil follows it
+	ModerateComments *bool `json:"moderate_comments"`
+	// Tags are slugs of the post tags. Names or slugs are accepted on writes, missing tags
+	// are created. Nil tags are kept as they are, an empty list removes all of them.
+	Tags      []string  `json:"tags" db:"-"`
+	CreatedAt time.Time `json:"created_at" db:"created_at,readonly"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at,readonly"`
+	UpdatedBy int       `json:"updated_by" db:"updated_by,readonly"`
+}
+
+// PostRevision is the state of a post after one of its writes, Rev numbers
+// revisions of a post from 1
+type PostRevision struct {
+	Id          int        `json:"id"`
+	PostId      int        `json:"post_id"`
+	Rev         int        `json:"rev"`
+	Title       string     `json:"title"`
+	Slug        string     `json:"slug"`
+	Body        string     `json:"body"`
+	Status      string     `json:"status"`
+	PublishedAt *time.Time `json:"published_at"`
+	CategoryId  int        `json:"category_id"`
+	Tags        []string   `json:"tags"`
+	CreatedAt   time.Time  `json:"created_at"`
+	// CreatedBy is the id of the user who made the revision, 0 for system changes
+	// such as scheduled publishing
+	CreatedBy int `json:"created_by"`
+}
+
+// PostDiff is a unified diff between two revisions of a post
+type PostDiff struct {
+	PostId int    `json:"post_id"`
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+	Diff   string `json:"diff"`
+}
+
+// PostInclude selects related resources read together with a post
+type PostInclude struct {
+	Author        bool
+	Comments      bool
+	CommentsLimit int
+}
+
+// PostExpanded is a post with its related resources, absent ones are nil
+type PostExpanded struct {
+	Post
+	Author   *User     `json:"author,omitempty"`
+	Comments []Comment `json:"comments,omitempty"`
+}
+
+// IsPublic reports whether everyone may see the post
+func (p Post) IsPublic() bool {
+	return p.Status == PostPublished || p.Status == PostArchived
 }
 
 type Comment struct {
-	Id     int       `json:"id"`
-	Date   time.Time `json:"date"`
-	Body   string    `json:"body"`
-	UserId int       `json:"user_id"`
-	PostId int       `json:"post_id"`
+	Id int `json:"id"`
+	// Body is Markdown, BodyHTML is rendered of it and sanitized by the application
+	Body     string `json:"body"`
+	BodyHTML string `json:"body_html" db:"body_html"`
+	UserId   int    `json:"user_id"`
+	// PostId and ParentId are set on create only, comments are not moved between posts
+	// and replies are not moved between threads
+	PostId   int `json:"post_id" db:"post_id,readonly"`
+	ParentId int `json:"parent_id" db:"parent_id,readonly"`
+	Depth    int `json:"depth" db:"depth,readonly"`
+	// DeletedAt is set for tombstones of deleted comments kept for their replies
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at,readonly"`
+	// Status is changed by moderators only, see CommentModeration
+	Status    string    `json:"status" db:"status,readonly"`
+	CreatedAt time.Time `json:"created_at" db:"created_at,readonly"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at,readonly"`
+	UpdatedBy int       `json:"updated_by" db:"updated_by,readonly"`
+}
+
+// Moderation statuses of a comment, only approved comments are public
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentRejected = "rejected"
+	CommentSpam     = "spam"
+)
+
+// ValidCommentStatus reports whether s is one of the known comment statuses
+func ValidCommentStatus(s string) bool {
+	switch s {
+	case CommentPending, CommentApproved, CommentRejected, CommentSpam:
+		return true
+	}
+	return false
+}
+
+// SpamCheck is the result of a spam check of a comment. Score is between 0 and 1,
+// Reasons name the signals which raised it.
+type SpamCheck struct {
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// QueuedComment is a comment in the moderation queue with its spam check
+type QueuedComment struct {
+	Comment
+	Spam SpamCheck `json:"spam"`
+}
+
+// CommentModeration is an entry of the moderation log. ModeratorId is 0 for
+// decisions of the application itself.
+type CommentModeration struct {
+	Id          int       `json:"id"`
+	CommentId   int       `json:"comment_id"`
+	FromStatus  string    `json:"from_status"`
+	Status      string    `json:"status"`
+	Reason      string    `json:"reason"`
+	ModeratorId int       `json:"moderator_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Orders of comments in a thread, they sort replies of every comment
+const (
+	ThreadOldest = "oldest"
+	ThreadNewest = "newest"
+	// ThreadTop puts comments with more replies first
+	ThreadTop = "top"
+)
+
+// CommentNode is a comment with its replies
+type CommentNode struct {
+	Comment
+	// ReplyCount counts all replies down the thread
+	ReplyCount int           `json:"reply_count"`
+	Replies    []CommentNode `json:"replies"`
+}
+
+// ThreadComment is a comment of a flattened thread, Path holds ids of the comment
+// and its parents from the top one
+type ThreadComment struct {
+	Comment
+	ReplyCount int   `json:"reply_count"`
+	Path       []int `json:"path"`
+}
+
+// Tag is a free-form label of posts
+type Tag struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	// Slug is made of the name unless it is set explicitly
+	Slug      string    `json:"slug"`
+	PostCount int       `json:"post_count" db:"post_count,readonly"`
+	CreatedAt time.Time `json:"created_at" db:"created_at,readonly"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at,readonly"`
+	UpdatedBy int       `json:"updated_by" db:"updated_by,readonly"`
+}
+
+// Category is a node of the category tree, every post belongs to at most one category
+type Category struct {
+	Id       int    `json:"id"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	ParentId int    `json:"parent_id"`
+	// PostCount counts public posts of the category and all its subcategories
+	PostCount int       `json:"post_count" db:"post_count,readonly"`
+	CreatedAt time.Time `json:"created_at" db:"created_at,readonly"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at,readonly"`
+	UpdatedBy int       `json:"updated_by" db:"updated_by,readonly"`
+}
+
+// CategoryNode is a category with its subcategories
+type CategoryNode struct {
+	Category
+	Children []CategoryNode `json:"children"`
+}
+
+type Session struct {
+	Id        string    `json:"-"`
+	Token     string    `json:"-"`
+	UserId    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type RefreshToken struct {
+	Id        string     `json:"-"`
+	Token     string     `json:"-"`
+	UserId    int        `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// TokenPair is the response of the token endpoint
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ValidPostStatus reports whether s is one of the known post statuses
+func ValidPostStatus(s string) bool {
+	switch s {
+	case PostDraft, PostScheduled, PostPublished, PostArchived:
+		return true
+	}
+	return false
+}
+
+// ListParams describes the requested page of a list.
+// A non-empty Cursor switches from offset to keyset pagination.
+type ListParams struct {
+	Limit   int
+	Offset  int
+	Cursor  string
+	Sort    string
+	Desc    bool
+	Filters map[string]int
+	// ViewerId sees own unpublished posts, ViewAll sees all of them
+	ViewerId int
+	ViewAll  bool
+}
+
+// Page is the pagination metadata of a list
+type Page struct {
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	Total      int    `json:"total"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Types of search results
+const (
+	SearchPost    = "post"
+	SearchComment = "comment"
+)
+
+// SearchParams is a full-text query with its filters. Results are sorted by rank,
+// so only offset pagination of ListParams is used.
+type SearchParams struct {
+	ListParams
+	Query string
+	// Type limits results to posts or comments, both are searched when empty
+	Type   string
+	UserId int
+	From   *time.Time
+	To     *time.Time
+}
+
+// SearchResult is a post or a comment matching a query. Snippet is an HTML-escaped
+// fragment of the body with matches wrapped in <mark>.
+type SearchResult struct {
+	Type      string    `json:"type"`
+	Id        int       `json:"id"`
+	PostId    int       `json:"post_id"`
+	UserId    int       `json:"user_id"`
+	Title     string    `json:"title"`
+	Snippet   string    `json:"snippet"`
+	Rank      float32   `json:"rank"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 func (u User) String() string {
-	return fmt.Sprintf("{\nID: %d\nUsername: %s\nPassword: %s\nFirstName: %s\nLastName: %s\nEmail: %s\nIsActive: %t\n}",
-		u.Id, u.Username, u.Password, u.FirstName, u.LastName, u.Email, u.IsActive)
+	// Password is never printed, the string goes to logs and traces
+	return fmt.Sprintf("{\nID: %d\nUsername: %s\nFirstName: %s\nLastName: %s\nEmail: %s\nIsActive: %t\nRole: %s\n}",
+		u.Id, u.Username, u.FirstName, u.LastName, u.Email, u.IsActive, u.Role)
+}
+
+// ValidRole reports whether r is one of the known roles
+func ValidRole(r string) bool {
+	switch r {
+	case RoleAdmin, RoleEditor, RoleAuthor, RoleCommenter:
+		return true
+	}
+	return false
 }
 
 func (p Post) String() string {
-	return fmt.Sprintf("{\nID: %d\nTitle: %s\nBody: %s\nUserId: %d\n}",
-		p.Id, p.Title, p.Body, p.UserId)
+	return fmt.Sprintf("{\nID: %d\nTitle: %s\nSlug: %s\nBody: %s\nUserId: %d\nStatus: %s\nCategoryId: %d\nTags: %v\n}",
+		p.Id, p.Title, p.Slug, p.Body, p.UserId, p.Status, p.CategoryId, p.Tags)
 }
 
 func (c Comment) String() string {
-	return fmt.Sprintf("{\nID: %d\nDate: %s\nBody: %s\nUserId: %d\nPostId: %d\n}",
-		c.Id, c.Date, c.Body, c.UserId, c.PostId)
+	return fmt.Sprintf("{\nID: %d\nCreatedAt: %s\nBody: %s\nUserId: %d\nPostId: %d\n}",
+		c.Id, c.CreatedAt, c.Body, c.UserId, c.PostId)
+}
+
+func (t Tag) String() string {
+	return fmt.Sprintf("{\nID: %d\nName: %s\nSlug: %s\n}",
+		t.Id, t.Name, t.Slug)
+}
+
+func (c Category) String() string {
+	return fmt.Sprintf("{\nID: %d\nName: %s\nSlug: %s\nParentId: %d\n}",
+		c.Id, c.Name, c.Slug, c.ParentId)
+}
+
+func (s Session) String() string {
+	return fmt.Sprintf("{\nUserId: %d\nCreatedAt: %s\nExpiresAt: %s\n}",
+		s.UserId, s.CreatedAt, s.ExpiresAt)
+}
+
+func (t RefreshToken) String() string {
+	return fmt.Sprintf("{\nUserId: %d\nCreatedAt: %s\nExpiresAt: %s\nRevoked: %t\n}",
+		t.UserId, t.CreatedAt, t.ExpiresAt, t.RevokedAt != nil)
 }
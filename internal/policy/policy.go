@@ -0,0 +1,278 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/auth"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+)
+
+// Machine-readable reasons of denials
+const (
+	ReasonUnauthenticated   = "unauthenticated"
+	ReasonInsufficientRole  = "insufficient_role"
+	ReasonNotOwner          = "not_owner"
+	ReasonOwnerChange       = "owner_change_forbidden"
+	ReasonRoleChange        = "role_change_forbidden"
+	ReasonActivationChange  = "activation_change_forbidden"
+	ReasonInactive          = "inactive_user"
+	ReasonUnknownRole       = "unknown_role"
+	ReasonSelfDeleteAsAdmin = "admin_self_delete"
+)
+
+// deny returns a forbidden error, or an unauthenticated one for anonymous actors.
+// The reason becomes the error code.
+func deny(action, reason string) error {
+	kind := apperr.KindForbidden
+	if reason == ReasonUnauthenticated || reason == ReasonInactive {
+		kind = apperr.KindUnauthenticated
+	}
+	return apperr.New(kind, reason, fmt.Sprintf("%s denied", action)).WithDetails("action", action)
+}
+
+type UserReader interface {
+	Read(ctx context.Context, id int) (*models.User, error)
+}
+
+// Policy decides whether the current user may perform an action.
+type Policy struct {
+	users UserReader
+}
+
+func New(u UserReader) *Policy {
+	return &Policy{
+		users: u,
+	}
+}
+
+// Actor returns the current user. Bearer tokens carry only the user id,
+// so the user is loaded to know the actual role.
+func (p *Policy) Actor(ctx context.Context, action string) (*models.User, error) {
+	if user, ok := auth.UserFromContext(ctx); ok {
+		return user, nil
+	}
+	id, ok := auth.UserID(ctx)
+	if !ok {
+		return nil, deny(action, ReasonUnauthenticated)
+	}
+	user, err := p.users.Read(ctx, id)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return nil, deny(action, ReasonUnauthenticated)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read current user: %w", err)
+	}
+	if !user.IsActive {
+		return nil, deny(action, ReasonInactive)
+	}
+	return user, nil
+}
+
+// Viewer returns the current user, or nil for anonymous requests and inactive users.
+func (p *Policy) Viewer(ctx context.Context) (*models.User, error) {
+	user, err := p.Actor(ctx, "view")
+	if errors.Is(err, apperr.ErrUnauthenticated) {
+		return nil, nil
+	}
+	return user, err
+}
+
+// IsModerator reports whether the user may manage content of others
+func IsModerator(u *models.User) bool {
+	return u.Role == models.RoleAdmin || u.Role == models.RoleEditor
+}
+
+func (p *Policy) CanCreateUser(actor *models.User, user models.User) error {
+	if actor.Role != models.RoleAdmin {
+		return deny("user.create", ReasonInsufficientRole)
+	}
+	if user.Role != "" && !models.ValidRole(user.Role) {
+		return deny("user.create", ReasonUnknownRole)
+	}
+	return nil
+}
+
+// CanUpdateUser allows users to edit themselves, only admins change roles and activation.
+func (p *Policy) CanUpdateUser(actor *models.User, current, update models.User, fields []string) error {
+	if actor.Role == models.RoleAdmin {
+		if update.Role != "" && !models.ValidRole(update.Role) {
+			return deny("user.update", ReasonUnknownRole)
+		}
+		return nil
+	}
+	if actor.Id != current.Id {
+		return deny("user.update", ReasonNotOwner)
+	}
+	if changes(fields, "role", update.Role != "" && update.Role != current.Role) {
+		return deny("user.update", ReasonRoleChange)
+	}
+	if changes(fields, "is_active", update.IsActive != current.IsActive) {
+		return deny("user.update", ReasonActivationChange)
+	}
+	return nil
+}
+
+func (p *Policy) CanDeleteUser(actor *models.User, user models.User) error {
+	if actor.Role != models.RoleAdmin {
+		return deny("user.delete", ReasonInsufficientRole)
+	}
+	if actor.Id == user.Id {
+		return deny("user.delete", ReasonSelfDeleteAsAdmin)
+	}
+	return nil
+}
+
+// CanViewPost allows everyone to see public posts, unpublished ones are seen
+// by their authors and moderators only.
+func (p *Policy) CanViewPost(viewer *models.User, post models.Post) bool {
+	if post.IsPublic() {
+		return true
+	}
+	return viewer != nil && (IsModerator(viewer) || viewer.Id == post.UserId)
+}
+
+// ScopePosts limits a list of posts to the ones the viewer may see.
+func (p *Policy) ScopePosts(viewer *models.User, params *models.ListParams) {
+	params.ViewAll = viewer != nil && IsModerator(viewer)
+	params.ViewerId = 0
+	if viewer != nil {
+		params.ViewerId = viewer.Id
+	}
+}
+
+func (p *Policy) CanCreatePost(actor *models.User) error {
+	if actor.Role == models.RoleCommenter {
+		return deny("post.create", ReasonInsufficientRole)
+	}
+	return nil
+}
+
+// CanUpdatePost allows authors to edit their own posts, editors and admins edit any post.
+func (p *Policy) CanUpdatePost(actor *models.User, current, update models.Post, fields []string) error {
+	if IsModerator(actor) {
+		return nil
+	}
+	if actor.Role == models.RoleCommenter {
+		return deny("post.update", ReasonInsufficientRole)
+	}
+	if current.UserId != actor.Id {
+		return deny("post.update", ReasonNotOwner)
+	}
+	if changes(fields, "user_id", update.UserId != 0 && update.UserId != current.UserId) {
+		return deny("post.update", ReasonOwnerChange)
+	}
+	return nil
+}
+
+func (p *Policy) CanDeletePost(actor *models.User, post models.Post) error {
+	if IsModerator(actor) {
+		return nil
+	}
+	if post.UserId != actor.Id {
+		return deny("post.delete", ReasonNotOwner)
+	}
+	return nil
+}
+
+// CanViewRevisions allows authors to see the history of their own posts,
+// editors and admins see the history of any post.
+func (p *Policy) CanViewRevisions(actor *models.User, post models.Post) error {
+	if IsModerator(actor) || post.UserId == actor.Id {
+		return nil
+	}
+	return deny("post.revisions", ReasonNotOwner)
+}
+
+// CanViewComment allows everyone to see approved comments, others are seen
+// by their authors and moderators only.
+func (p *Policy) CanViewComment(viewer *models.User, comment models.Comment) bool {
+	if comment.Status == models.CommentApproved {
+		return true
+	}
+	return viewer != nil && (IsModerator(viewer) || viewer.Id == comment.UserId)
+}
+
+// ScopeComments limits a list of comments to the ones the viewer may see.
+func (p *Policy) ScopeComments(viewer *models.User, params *models.ListParams) {
+	params.ViewAll = viewer != nil && IsModerator(viewer)
+	params.ViewerId = 0
+	if viewer != nil {
+		params.ViewerId = viewer.Id
+	}
+}
+
+func (p *Policy) CanCreateComment(actor *models.User) error {
+	return nil
+}
+
+// CanUpdateComment allows users to edit their own comments, editors and admins moderate any comment.
+func (p *Policy) CanUpdateComment(actor *models.User, current, update models.Comment, fields []string) error {
+	if IsModerator(actor) {
+		return nil
+	}
+	if current.UserId != actor.Id {
+		return deny("comment.update", ReasonNotOwner)
+	}
+	if changes(fields, "user_id", update.UserId != 0 && update.UserId != current.UserId) {
+		return deny("comment.update", ReasonOwnerChange)
+	}
+	return nil
+}
+
+func (p *Policy) CanDeleteComment(actor *models.User, comment models.Comment) error {
+	if IsModerator(actor) {
+		return nil
+	}
+	if comment.UserId != actor.Id {
+		return deny("comment.delete", ReasonNotOwner)
+	}
+	return nil
+}
+
+// CanModerateComments allows editors and admins to approve and reject comments.
+func (p *Policy) CanModerateComments(actor *models.User) error {
+	if !IsModerator(actor) {
+		return deny("comment.moderate", ReasonInsufficientRole)
+	}
+	return nil
+}
+
+// CanCreateTag allows everyone who writes posts to add tags, posts create missing tags as well.
+func (p *Policy) CanCreateTag(actor *models.User) error {
+	if actor.Role == models.RoleCommenter {
+		return deny("tag.create", ReasonInsufficientRole)
+	}
+	return nil
+}
+
+// CanManageTags allows editors and admins to rename and delete tags.
+func (p *Policy) CanManageTags(actor *models.User, action string) error {
+	if !IsModerator(actor) {
+		return deny(action, ReasonInsufficientRole)
+	}
+	return nil
+}
+
+// CanManageCategories allows editors and admins to change the category tree.
+func (p *Policy) CanManageCategories(actor *models.User, action string) error {
+	if !IsModerator(actor) {
+		return deny(action, ReasonInsufficientRole)
+	}
+	return nil
+}
+
+// changes reports whether field is going to be changed. With an explicit mask the field
+// changes if it is in the mask, otherwise only non-zero values are written.
+func changes(fields []string, field string, differs bool) bool {
+	if len(fields) == 0 {
+		return differs
+	}
+	for _, f := range fields {
+		if f == field {
+			return differs
+		}
+	}
+	return false
+}
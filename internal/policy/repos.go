@@ -0,0 +1,585 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/categoryrepo"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/commentrepo"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/postrepo"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/searchrepo"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/tagrepo"
+	"github.com/ptsypyshev/simple-blog/internal/repositories/userrepo"
+)
+
+// Users checks the policy before calling userrepo.Users.
+type Users struct {
+	repo   userrepo.Users
+	policy *Policy
+}
+
+func NewUsers(r userrepo.Users, p *Policy) *Users {
+	return &Users{
+		repo:   r,
+		policy: p,
+	}
+}
+
+func (u Users) Create(ctx context.Context, user models.User) (*models.User, error) {
+	actor, err := u.policy.Actor(ctx, "user.create")
+	if err != nil {
+		return nil, err
+	}
+	if err := u.policy.CanCreateUser(actor, user); err != nil {
+		return nil, err
+	}
+	return u.repo.Create(ctx, user)
+}
+
+func (u Users) Read(ctx context.Context, id int) (*models.User, error) {
+	return u.repo.Read(ctx, id)
+}
+
+func (u Users) List(ctx context.Context, params models.ListParams) ([]models.User, *models.Page, error) {
+	return u.repo.List(ctx, params)
+}
+
+func (u Users) Update(ctx context.Context, user models.User, fields ...string) (*models.User, error) {
+	actor, err := u.policy.Actor(ctx, "user.update")
+	if err != nil {
+		return nil, err
+	}
+	current, err := u.repo.Read(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.policy.CanUpdateUser(actor, *current, user, fields); err != nil {
+		return nil, err
+	}
+	return u.repo.Update(ctx, user, fields...)
+}
+
+func (u Users) Delete(ctx context.Context, id int) (*models.User, error) {
+	actor, err := u.policy.Actor(ctx, "user.delete")
+	if err != nil {
+		return nil, err
+	}
+	current, err := u.repo.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.policy.CanDeleteUser(actor, *current); err != nil {
+		return nil, err
+	}
+	return u.repo.Delete(ctx, id)
+}
+
+// Posts checks the policy before calling postrepo.Posts.
+type Posts struct {
+	repo   postrepo.Posts
+	policy *Policy
+}
+
+func NewPosts(r postrepo.Posts, p *Policy) *Posts {
+	return &Posts{
+		repo:   r,
+		policy: p,
+	}
+}
+
+func (p Posts) Create(ctx context.Context, post models.Post) (*models.Post, error) {
+	actor, err := p.policy.Actor(ctx, "post.create")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.policy.CanCreatePost(actor); err != nil {
+		return nil, err
+	}
+	return p.repo.Create(ctx, post)
+}
+
+// Read hides unpublished posts of others as if they did not exist.
+func (p Posts) Read(ctx context.Context, id int) (*models.Post, error) {
+	post, err := p.repo.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkVisible(ctx, *post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// ReadBySlug hides unpublished posts of others as Read does, before a redirect from an old slug.
+func (p Posts) ReadBySlug(ctx context.Context, slug string) (*models.Post, error) {
+	post, err := p.repo.ReadBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkVisible(ctx, *post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (p Posts) List(ctx context.Context, params models.ListParams) ([]models.Post, *models.Page, error) {
+	viewer, err := p.policy.Viewer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.policy.ScopePosts(viewer, &params)
+	return p.repo.List(ctx, params)
+}
+
+func (p Posts) ListByUser(ctx context.Context, userID int, params models.ListParams) ([]models.Post, *models.Page, error) {
+	viewer, err := p.policy.Viewer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.policy.ScopePosts(viewer, &params)
+	return p.repo.ListByUser(ctx, userID, params)
+}
+
+func (p Posts) ListByTag(ctx context.Context, tag string, params models.ListParams) ([]models.Post, *models.Page, error) {
+	viewer, err := p.policy.Viewer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.policy.ScopePosts(viewer, &params)
+	return p.repo.ListByTag(ctx, tag, params)
+}
+
+func (p Posts) ListByCategory(ctx context.Context, category string, params models.ListParams) ([]models.Post, *models.Page, error) {
+	viewer, err := p.policy.Viewer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.policy.ScopePosts(viewer, &params)
+	return p.repo.ListByCategory(ctx, category, params)
+}
+
+func (p Posts) ReadExpanded(ctx context.Context, id int, include models.PostInclude) (*models.PostExpanded, error) {
+	post, err := p.repo.ReadExpanded(ctx, id, include)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkVisible(ctx, post.Post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (p Posts) ListRevisions(ctx context.Context, id int, params models.ListParams) ([]models.PostRevision, *models.Page, error) {
+	if err := p.checkRevisions(ctx, id); err != nil {
+		return nil, nil, err
+	}
+	return p.repo.ListRevisions(ctx, id, params)
+}
+
+func (p Posts) ReadRevision(ctx context.Context, id, rev int) (*models.PostRevision, error) {
+	if err := p.checkRevisions(ctx, id); err != nil {
+		return nil, err
+	}
+	return p.repo.ReadRevision(ctx, id, rev)
+}
+
+func (p Posts) Diff(ctx context.Context, id, from, to int) (*models.PostDiff, error) {
+	if err := p.checkRevisions(ctx, id); err != nil {
+		return nil, err
+	}
+	return p.repo.Diff(ctx, id, from, to)
+}
+
+// Restore is an update of the restored fields.
+func (p Posts) Restore(ctx context.Context, id, rev int) (*models.Post, error) {
+	actor, err := p.policy.Actor(ctx, "post.update")
+	if err != nil {
+		return nil, err
+	}
+	current, err := p.repo.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.policy.CanUpdatePost(actor, *current, models.Post{Id: id}, postrepo.RestoreFields); err != nil {
+		return nil, err
+	}
+	return p.repo.Restore(ctx, id, rev)
+}
+
+// checkRevisions hides the history of posts the actor cannot see, and denies it
+// for visible posts of others.
+func (p Posts) checkRevisions(ctx context.Context, id int) error {
+	actor, err := p.policy.Actor(ctx, "post.revisions")
+	if err != nil {
+		return err
+	}
+	current, err := p.repo.Read(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !p.policy.CanViewPost(actor, *current) {
+		return fmt.Errorf("%w: post id %d", apperr.ErrNotFound, id)
+	}
+	return p.policy.CanViewRevisions(actor, *current)
+}
+
+func (p Posts) checkVisible(ctx context.Context, post models.Post) error {
+	viewer, err := p.policy.Viewer(ctx)
+	if err != nil {
+		return err
+	}
+	if !p.policy.CanViewPost(viewer, post) {
+		return fmt.Errorf("%w: post id %d", apperr.ErrNotFound, post.Id)
+	}
+	return nil
+}
+
+func (p Posts) Update(ctx context.Context, post models.Post, fields ...string) (*models.Post, error) {
+	actor, err := p.policy.Actor(ctx, "post.update")
+	if err != nil {
+		return nil, err
+	}
+	current, err := p.repo.Read(ctx, post.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.policy.CanUpdatePost(actor, *current, post, fields); err != nil {
+		return nil, err
+	}
+	return p.repo.Update(ctx, post, fields...)
+}
+
+func (p Posts) Delete(ctx context.Context, id int) (*models.Post, error) {
+	actor, err := p.policy.Actor(ctx, "post.delete")
+	if err != nil {
+		return nil, err
+	}
+	current, err := p.repo.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.policy.CanDeletePost(actor, *current); err != nil {
+		return nil, err
+	}
+	return p.repo.Delete(ctx, id)
+}
+
+// Comments checks the policy before calling commentrepo.Comments.
+// Comments of posts hidden from the viewer are hidden as well, posts checks it.
+type Comments struct {
+	repo   commentrepo.Comments
+	posts  *Posts
+	policy *Policy
+}
+
+func NewComments(r commentrepo.Comments, posts *Posts, p *Policy) *Comments {
+	return &Comments{
+		repo:   r,
+		posts:  posts,
+		policy: p,
+	}
+}
+
+// Create approves comments of moderators at once, a status from the request is never kept.
+// Hidden posts cannot be commented, they are reported as missing ones.
+func (c Comments) Create(ctx context.Context, comment models.Comment) (*models.Comment, error) {
+	actor, err := c.policy.Actor(ctx, "comment.create")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.policy.CanCreateComment(actor); err != nil {
+		return nil, err
+	}
+	postID := comment.PostId
+	if postID == 0 && comment.ParentId != 0 {
+		// A missing parent is reported by the repo
+		if parent, err := c.repo.Read(ctx, comment.ParentId); err == nil {
+			postID = parent.PostId
+		}
+	}
+	if postID != 0 {
+		err := c.checkPost(ctx, postID)
+		if errors.Is(err, apperr.ErrNotFound) {
+			err = apperr.Validation("unknown_post", "the post does not exist").WithDetails("field", "post_id")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	comment.Status = ""
+	if IsModerator(actor) {
+		comment.Status = models.CommentApproved
+	}
+	return c.repo.Create(ctx, comment)
+}
+
+// Read hides comments which are not approved as if they did not exist.
+func (c Comments) Read(ctx context.Context, id int) (*models.Comment, error) {
+	comment, err := c.repo.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	viewer, err := c.policy.Viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !c.policy.CanViewComment(viewer, *comment) {
+		return nil, fmt.Errorf("%w: comment id %d", apperr.ErrNotFound, id)
+	}
+	if comment.PostId != 0 {
+		err := c.checkPost(ctx, comment.PostId)
+		if errors.Is(err, apperr.ErrNotFound) {
+			err = fmt.Errorf("%w: comment id %d", apperr.ErrNotFound, id)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return comment, nil
+}
+
+func (c Comments) List(ctx context.Context, params models.ListParams) ([]models.Comment, *models.Page, error) {
+	viewer, err := c.policy.Viewer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.policy.ScopeComments(viewer, &params)
+	return c.repo.List(ctx, params)
+}
+
+func (c Comments) ListByPost(ctx context.Context, postID int, params models.ListParams) ([]models.Comment, *models.Page, error) {
+	if err := c.checkPost(ctx, postID); err != nil {
+		return nil, nil, err
+	}
+	viewer, err := c.policy.Viewer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.policy.ScopeComments(viewer, &params)
+	return c.repo.ListByPost(ctx, postID, params)
+}
+
+func (c Comments) Thread(ctx context.Context, postID int, order string) ([]models.CommentNode, error) {
+	if err := c.checkPost(ctx, postID); err != nil {
+		return nil, err
+	}
+	viewer, err := c.policy.Viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var scope models.ListParams
+	c.policy.ScopeComments(viewer, &scope)
+	return c.repo.Thread(ctx, postID, order, scope)
+}
+
+func (c Comments) FlatThread(ctx context.Context, postID int, order string) ([]models.ThreadComment, error) {
+	if err := c.checkPost(ctx, postID); err != nil {
+		return nil, err
+	}
+	viewer, err := c.policy.Viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var scope models.ListParams
+	c.policy.ScopeComments(viewer, &scope)
+	return c.repo.FlatThread(ctx, postID, order, scope)
+}
+
+func (c Comments) Queue(ctx context.Context, status string, params models.ListParams) ([]models.QueuedComment, *models.Page, error) {
+	if err := c.checkModerator(ctx); err != nil {
+		return nil, nil, err
+	}
+	return c.repo.Queue(ctx, status, params)
+}
+
+func (c Comments) Moderate(ctx context.Context, ids []int, status, reason string) ([]models.Comment, error) {
+	if err := c.checkModerator(ctx); err != nil {
+		return nil, err
+	}
+	return c.repo.Moderate(ctx, ids, status, reason)
+}
+
+func (c Comments) ModerationLog(ctx context.Context, params models.ListParams) ([]models.CommentModeration, *models.Page, error) {
+	if err := c.checkModerator(ctx); err != nil {
+		return nil, nil, err
+	}
+	return c.repo.ModerationLog(ctx, params)
+}
+
+// checkPost fails with apperr.ErrNotFound if the post does not exist or the viewer
+// cannot see it, so hidden posts are not told from missing ones.
+func (c Comments) checkPost(ctx context.Context, postID int) error {
+	_, err := c.posts.Read(ctx, postID)
+	return err
+}
+
+func (c Comments) checkModerator(ctx context.Context) error {
+	actor, err := c.policy.Actor(ctx, "comment.moderate")
+	if err != nil {
+		return err
+	}
+	return c.policy.CanModerateComments(actor)
+}
+
+func (c Comments) Update(ctx context.Context, comment models.Comment, fields ...string) (*models.Comment, error) {
+	actor, err := c.policy.Actor(ctx, "comment.update")
+	if err != nil {
+		return nil, err
+	}
+	current, err := c.repo.Read(ctx, comment.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.policy.CanUpdateComment(actor, *current, comment, fields); err != nil {
+		return nil, err
+	}
+	// Edits of moderators never send comments back to moderation
+	return c.repo.Update(ctx, comment, IsModerator(actor), fields...)
+}
+
+func (c Comments) Delete(ctx context.Context, id int) (*models.Comment, error) {
+	actor, err := c.policy.Actor(ctx, "comment.delete")
+	if err != nil {
+		return nil, err
+	}
+	current, err := c.repo.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.policy.CanDeleteComment(actor, *current); err != nil {
+		return nil, err
+	}
+	return c.repo.Delete(ctx, id)
+}
+
+// Tags checks the policy before calling tagrepo.Tags.
+type Tags struct {
+	repo   tagrepo.Tags
+	policy *Policy
+}
+
+func NewTags(r tagrepo.Tags, p *Policy) *Tags {
+	return &Tags{
+		repo:   r,
+		policy: p,
+	}
+}
+
+func (t Tags) Create(ctx context.Context, tag models.Tag) (*models.Tag, error) {
+	actor, err := t.policy.Actor(ctx, "tag.create")
+	if err != nil {
+		return nil, err
+	}
+	if err := t.policy.CanCreateTag(actor); err != nil {
+		return nil, err
+	}
+	return t.repo.Create(ctx, tag)
+}
+
+func (t Tags) ReadBySlug(ctx context.Context, slug string) (*models.Tag, error) {
+	return t.repo.ReadBySlug(ctx, slug)
+}
+
+func (t Tags) List(ctx context.Context, params models.ListParams) ([]models.Tag, *models.Page, error) {
+	return t.repo.List(ctx, params)
+}
+
+func (t Tags) Update(ctx context.Context, tag models.Tag, fields ...string) (*models.Tag, error) {
+	actor, err := t.policy.Actor(ctx, "tag.update")
+	if err != nil {
+		return nil, err
+	}
+	if err := t.policy.CanManageTags(actor, "tag.update"); err != nil {
+		return nil, err
+	}
+	return t.repo.Update(ctx, tag, fields...)
+}
+
+func (t Tags) Delete(ctx context.Context, id int) (*models.Tag, error) {
+	actor, err := t.policy.Actor(ctx, "tag.delete")
+	if err != nil {
+		return nil, err
+	}
+	if err := t.policy.CanManageTags(actor, "tag.delete"); err != nil {
+		return nil, err
+	}
+	return t.repo.Delete(ctx, id)
+}
+
+// Categories checks the policy before calling categoryrepo.Categories.
+type Categories struct {
+	repo   categoryrepo.Categories
+	policy *Policy
+}
+
+func NewCategories(r categoryrepo.Categories, p *Policy) *Categories {
+	return &Categories{
+		repo:   r,
+		policy: p,
+	}
+}
+
+func (c Categories) Create(ctx context.Context, category models.Category) (*models.Category, error) {
+	actor, err := c.policy.Actor(ctx, "category.create")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.policy.CanManageCategories(actor, "category.create"); err != nil {
+		return nil, err
+	}
+	return c.repo.Create(ctx, category)
+}
+
+func (c Categories) ReadBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	return c.repo.ReadBySlug(ctx, slug)
+}
+
+func (c Categories) Tree(ctx context.Context) ([]models.CategoryNode, error) {
+	return c.repo.Tree(ctx)
+}
+
+func (c Categories) Update(ctx context.Context, category models.Category, fields ...string) (*models.Category, error) {
+	actor, err := c.policy.Actor(ctx, "category.update")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.policy.CanManageCategories(actor, "category.update"); err != nil {
+		return nil, err
+	}
+	return c.repo.Update(ctx, category, fields...)
+}
+
+func (c Categories) Delete(ctx context.Context, id int) (*models.Category, error) {
+	actor, err := c.policy.Actor(ctx, "category.delete")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.policy.CanManageCategories(actor, "category.delete"); err != nil {
+		return nil, err
+	}
+	return c.repo.Delete(ctx, id)
+}
+
+// Search limits results of searchrepo.Search to posts the viewer may see and their comments.
+type Search struct {
+	repo   searchrepo.Search
+	policy *Policy
+}
+
+func NewSearch(r searchrepo.Search, p *Policy) *Search {
+	return &Search{
+		repo:   r,
+		policy: p,
+	}
+}
+
+func (s Search) Search(ctx context.Context, params models.SearchParams) ([]models.SearchResult, *models.Page, error) {
+	viewer, err := s.policy.Viewer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.policy.ScopePosts(viewer, &params.ListParams)
+	return s.repo.Search(ctx, params)
+}
@@ -0,0 +1,62 @@
+package redact
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Placeholder replaces redacted values.
+const Placeholder = "[REDACTED]"
+
+// sensitiveKeys are parts of field names which carry credentials.
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "authorization", "cookie"}
+
+// bcryptRe matches bcrypt hashes as stored by crypt(..., gen_salt('bf')).
+var bcryptRe = regexp.MustCompile(`\$2[abxy]?\$\d{2}\$[./A-Za-z0-9]{53}`)
+
+// IsSensitive reports whether a field with this name must never be logged.
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range sensitiveKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// String removes password hashes from free text.
+func String(s string) string {
+	return bcryptRe.ReplaceAllString(s, Placeholder)
+}
+
+// Value returns a safe value of the field key. Maps and slices are copied with
+// their values made safe, e.g. the password of a logged request body.
+func Value(key string, value interface{}) interface{} {
+	if IsSensitive(key) {
+		return Placeholder
+	}
+	switch v := value.(type) {
+	case string:
+		return String(v)
+	case []string:
+		res := make([]string, len(v))
+		for i, s := range v {
+			res[i] = String(s)
+		}
+		return res
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			res[k] = Value(k, e)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, e := range v {
+			res[i] = Value(key, e)
+		}
+		return res
+	}
+	return value
+}
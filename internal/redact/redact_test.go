@@ -0,0 +1,109 @@
+package redact
+
+import (
+	"reflect"
+	"testing"
+)
+
+const hash = "$2a$08$KUQ3zH1Cg3z0p1Nn7bJ6ZuKx6bXy0sZy6H0m1l8cN2yQb6i4tJg2C"
+
+func TestIsSensitive(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"password", true},
+		{"Password", true},
+		{"user.passwd", true},
+		{"jwt_secret", true},
+		{"refresh_token", true},
+		{"csrf_token", true},
+		{"Authorization", true},
+		{"http.request.header.cookie", true},
+		{"username", false},
+		{"email", false},
+		{"sql", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := IsSensitive(tt.key); got != tt.want {
+				t.Errorf("IsSensitive(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"hash", hash, Placeholder},
+		{"hash in text", "user {1 admin " + hash + " Admin}", "user {1 admin " + Placeholder + " Admin}"},
+		{"two hashes", hash + "," + hash, Placeholder + "," + Placeholder},
+		{"plain text", "SELECT id FROM users WHERE id = $1", "SELECT id FROM users WHERE id = $1"},
+		{"short dollar text", "$2a$08$short", "$2a$08$short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := String(tt.in); got != tt.want {
+				t.Errorf("String(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value interface{}
+		want  interface{}
+	}{
+		{"sensitive key", "password", "secret", Placeholder},
+		{"sensitive key of any type", "token", 42, Placeholder},
+		{"hash in string", "row", "admin " + hash, "admin " + Placeholder},
+		{"other types", "id", 42, 42},
+		{"string slice", "rows", []string{hash, "admin"}, []string{Placeholder, "admin"}},
+		{
+			"map",
+			"body",
+			map[string]interface{}{"username": "admin", "password": "secret", "refresh_token": "abc"},
+			map[string]interface{}{"username": "admin", "password": Placeholder, "refresh_token": Placeholder},
+		},
+		{
+			"nested map",
+			"request",
+			map[string]interface{}{
+				"user":    map[string]interface{}{"id": 1, "password": "secret"},
+				"headers": map[string]interface{}{"Authorization": "Bearer abc"},
+			},
+			map[string]interface{}{
+				"user":    map[string]interface{}{"id": 1, "password": Placeholder},
+				"headers": map[string]interface{}{"Authorization": Placeholder},
+			},
+		},
+		{
+			"slice of maps",
+			"users",
+			[]interface{}{map[string]interface{}{"id": 1, "secret": "x"}, hash},
+			[]interface{}{map[string]interface{}{"id": 1, "secret": Placeholder}, Placeholder},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Value(tt.key, tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Value(%q, %v) = %v, want %v", tt.key, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValueKeepsOriginal(t *testing.T) {
+	m := map[string]interface{}{"password": "secret"}
+	Value("body", m)
+	if m["password"] != "secret" {
+		t.Errorf("original map is changed: %v", m)
+	}
+}
@@ -0,0 +1,72 @@
+package redact
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type exporter struct {
+	sdktrace.SpanExporter
+}
+
+// NewExporter wraps a span exporter so that attributes, events and statuses
+// of exported spans never carry credentials.
+func NewExporter(e sdktrace.SpanExporter) sdktrace.SpanExporter {
+	return &exporter{e}
+}
+
+func (e *exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	safe := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, s := range spans {
+		safe[i] = span{s}
+	}
+	return e.SpanExporter.ExportSpans(ctx, safe)
+}
+
+type span struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s span) Attributes() []attribute.KeyValue {
+	return Attributes(s.ReadOnlySpan.Attributes())
+}
+
+func (s span) Events() []sdktrace.Event {
+	events := s.ReadOnlySpan.Events()
+	res := make([]sdktrace.Event, len(events))
+	for i, e := range events {
+		e.Attributes = Attributes(e.Attributes)
+		res[i] = e
+	}
+	return res
+}
+
+func (s span) Status() sdktrace.Status {
+	status := s.ReadOnlySpan.Status()
+	status.Description = String(status.Description)
+	return status
+}
+
+// Attributes returns a copy of span attributes with sensitive values replaced.
+func Attributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	res := make([]attribute.KeyValue, len(attrs))
+	for i, kv := range attrs {
+		key := string(kv.Key)
+		switch {
+		case IsSensitive(key):
+			res[i] = kv.Key.String(Placeholder)
+		case kv.Value.Type() == attribute.STRING:
+			res[i] = kv.Key.String(String(kv.Value.AsString()))
+		case kv.Value.Type() == attribute.STRINGSLICE:
+			values := kv.Value.AsStringSlice()
+			for j, v := range values {
+				values[j] = String(v)
+			}
+			res[i] = kv.Key.StringSlice(values)
+		default:
+			res[i] = kv
+		}
+	}
+	return res
+}
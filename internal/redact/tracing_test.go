@@ -0,0 +1,115 @@
+package redact
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+func TestExporter(t *testing.T) {
+	tests := []struct {
+		name string
+		span func(s trace.Span)
+		want []attribute.KeyValue
+	}{
+		{
+			"sensitive attributes",
+			func(s trace.Span) {
+				s.SetAttributes(
+					attribute.String("user.password", "secret"),
+					attribute.String("http.request.header.authorization", "Bearer abc"),
+					attribute.Int("user.id", 1),
+				)
+			},
+			[]attribute.KeyValue{
+				attribute.String("user.password", Placeholder),
+				attribute.String("http.request.header.authorization", Placeholder),
+				attribute.Int("user.id", 1),
+			},
+		},
+		{
+			"hash in string attributes",
+			func(s trace.Span) {
+				s.SetAttributes(
+					attribute.String("db.result", "admin "+hash),
+					attribute.StringSlice("db.rows", []string{hash, "admin"}),
+				)
+			},
+			[]attribute.KeyValue{
+				attribute.String("db.result", "admin "+Placeholder),
+				attribute.StringSlice("db.rows", []string{Placeholder, "admin"}),
+			},
+		},
+		{
+			"safe attributes",
+			func(s trace.Span) {
+				s.SetAttributes(attribute.String("db.statement", "SELECT 1"), attribute.Bool("ok", true))
+			},
+			[]attribute.KeyValue{attribute.String("db.statement", "SELECT 1"), attribute.Bool("ok", true)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans := exportSpan(t, tt.span)
+			if got := spans[0].Attributes; !equalAttrs(got, tt.want) {
+				t.Errorf("attributes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExporterEventsAndStatus(t *testing.T) {
+	spans := exportSpan(t, func(s trace.Span) {
+		s.AddEvent("user", trace.WithAttributes(attribute.String("password", "secret"), attribute.String("row", hash)))
+		s.RecordError(errors.New("bad hash " + hash))
+		s.SetStatus(codes.Error, "bad hash "+hash)
+	})
+	span := spans[0]
+
+	want := []attribute.KeyValue{attribute.String("password", Placeholder), attribute.String("row", Placeholder)}
+	if got := span.Events[0].Attributes; !equalAttrs(got, want) {
+		t.Errorf("event attributes = %v, want %v", got, want)
+	}
+	for _, kv := range span.Events[1].Attributes {
+		if kv.Value.Type() == attribute.STRING && kv.Value.AsString() == "bad hash "+hash {
+			t.Errorf("error event carries the hash: %v", kv)
+		}
+	}
+	if got, want := span.Status.Description, "bad hash "+Placeholder; got != want {
+		t.Errorf("status = %q, want %q", got, want)
+	}
+}
+
+func exportSpan(t *testing.T, f func(s trace.Span)) tracetest.SpanStubs {
+	t.Helper()
+	mem := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(NewExporter(mem)))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	_, span := tp.Tracer("test").Start(context.Background(), "span")
+	f(span)
+	span.End()
+
+	spans := mem.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	return spans
+}
+
+func equalAttrs(got, want []attribute.KeyValue) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i].Key != want[i].Key || got[i].Value.Emit() != want[i].Value.Emit() {
+			return false
+		}
+	}
+	return true
+}
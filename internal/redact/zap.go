@@ -0,0 +1,55 @@
+package redact
+
+import (
+	"fmt"
+	"go.uber.org/zap/zapcore"
+)
+
+type core struct {
+	zapcore.Core
+}
+
+// NewCore wraps a zap core so that credential fields and password hashes are never written.
+// Use it with zap.WrapCore.
+func NewCore(c zapcore.Core) zapcore.Core {
+	return &core{c}
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	return &core{c.Core.With(Fields(fields))}
+}
+
+func (c *core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = String(ent.Message)
+	return c.Core.Write(ent, Fields(fields))
+}
+
+// Fields returns a copy of zap fields with sensitive values replaced.
+func Fields(fields []zapcore.Field) []zapcore.Field {
+	res := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch {
+		case IsSensitive(f.Key):
+			f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: Placeholder}
+		case f.Type == zapcore.StringType:
+			f.String = String(f.String)
+		case f.Type == zapcore.StringerType:
+			f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: String(fmt.Sprint(f.Interface))}
+		case f.Type == zapcore.ReflectType:
+			f.Interface = Value(f.Key, f.Interface)
+		case f.Type == zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok && err != nil {
+				f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: String(err.Error())}
+			}
+		}
+		res[i] = f
+	}
+	return res
+}
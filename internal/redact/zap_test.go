@@ -0,0 +1,61 @@
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"strings"
+	"testing"
+)
+
+func TestCore(t *testing.T) {
+	tests := []struct {
+		name  string
+		log   func(l *zap.Logger)
+		field string
+	}{
+		{"password field", func(l *zap.Logger) { l.Info("login", zap.String("password", "secret")) }, "password"},
+		{"token field", func(l *zap.Logger) { l.Info("refresh", zap.String("refresh_token", "secret")) }, "refresh_token"},
+		{"hash in string", func(l *zap.Logger) { l.Info("row", zap.String("row", hash)) }, "row"},
+		{"hash in error", func(l *zap.Logger) { l.Error("failed", zap.Error(errors.New("bad hash "+hash))) }, "error"},
+		{"hash in stringer", func(l *zap.Logger) { l.Info("user", zap.Stringer("user", stringer(hash))) }, "user"},
+		{"nested password", func(l *zap.Logger) {
+			l.Info("body", zap.Any("body", map[string]interface{}{"user": map[string]interface{}{"password": "secret"}}))
+		}, "body"},
+		{"hash in message", func(l *zap.Logger) { l.Info("user hash " + hash) }, ""},
+		{"password in With", func(l *zap.Logger) { l.With(zap.String("jwt_secret", "secret")).Info("signer") }, "jwt_secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obs, logs := observer.New(zapcore.DebugLevel)
+			tt.log(zap.New(NewCore(obs)))
+
+			entries := logs.AllUntimed()
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			e := entries[0]
+			if strings.Contains(e.Message, hash) {
+				t.Errorf("message carries the hash: %q", e.Message)
+			}
+			fields := e.ContextMap()
+			if tt.field != "" {
+				if _, ok := fields[tt.field]; !ok {
+					t.Errorf("field %q is dropped, want it redacted", tt.field)
+				}
+			}
+			for k, v := range fields {
+				s := fmt.Sprint(v)
+				if strings.Contains(s, "secret") || strings.Contains(s, hash) {
+					t.Errorf("field %q carries a credential: %s", k, s)
+				}
+			}
+		})
+	}
+}
+
+type stringer string
+
+func (s stringer) String() string { return string(s) }
@@ -0,0 +1,230 @@
+package authrepo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/auth"
+	"github.com/ptsypyshev/simple-blog/internal/config"
+	"github.com/ptsypyshev/simple-blog/internal/db/pgdb"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"github.com/ptsypyshev/simple-blog/internal/metrics"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"go.uber.org/zap"
+	"time"
+)
+
+var (
+	ErrInvalidCredentials = apperr.Unauthenticated("invalid_credentials", "invalid username or password")
+	ErrInvalidSession     = apperr.Unauthenticated("invalid_session", "invalid or expired session")
+	ErrInvalidToken       = apperr.Unauthenticated("invalid_token", "invalid or expired token")
+)
+
+type CredentialStorage interface {
+	ReadByCredentials(ctx context.Context, username, password string) (*models.User, error)
+	Read(ctx context.Context, id int) (*models.User, error)
+}
+
+type SessionStorage interface {
+	Create(ctx context.Context, session models.Session) (*models.Session, error)
+	Read(ctx context.Context, id string) (*models.Session, error)
+	Delete(ctx context.Context, id string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type RefreshTokenStorage interface {
+	Create(ctx context.Context, token models.RefreshToken) (*models.RefreshToken, error)
+	Read(ctx context.Context, id string) (*models.RefreshToken, error)
+	Rotate(ctx context.Context, oldID, newID string, expiresAt time.Time) (*models.RefreshToken, error)
+	RevokeByUser(ctx context.Context, userID int) error
+}
+
+type Auth struct {
+	cs         CredentialStorage
+	ss         SessionStorage
+	rs         RefreshTokenStorage
+	signer     *auth.Signer
+	sessionTTL time.Duration
+	refreshTTL time.Duration
+	logger     *zap.Logger
+}
+
+func NewAuth(c CredentialStorage, s SessionStorage, r RefreshTokenStorage, signer *auth.Signer, cfg config.Auth, l *zap.Logger) *Auth {
+	return &Auth{
+		cs:         c,
+		ss:         s,
+		rs:         r,
+		signer:     signer,
+		sessionTTL: cfg.SessionTTL.Duration,
+		refreshTTL: cfg.JWT.RefreshTTL.Duration,
+		logger:     l,
+	}
+}
+
+// Login checks credentials and starts a new session. Only the returned session
+// carries the token, the storage keeps its hash.
+func (a Auth) Login(ctx context.Context, username, password string) (*models.Session, *models.User, error) {
+	user, err := a.cs.ReadByCredentials(ctx, username, password)
+	if errors.Is(err, pgdb.ErrNotFound) {
+		logctx.Logger(ctx, a.logger).Warn("login failed", zap.String("username", username))
+		metrics.LoginsFailed.WithLabelValues("session").Inc()
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		logctx.Logger(ctx, a.logger).Error(fmt.Sprintf(`cannot check credentials: %s`, err))
+		return nil, nil, fmt.Errorf("cannot check credentials: %w", err)
+	}
+
+	if _, err := a.ss.DeleteExpired(ctx); err != nil {
+		logctx.Logger(ctx, a.logger).Warn(fmt.Sprintf(`cannot delete expired sessions: %s`, err))
+	}
+
+	token, err := NewToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	session, err := a.ss.Create(ctx, models.Session{
+		Id:        HashToken(token),
+		UserId:    user.Id,
+		ExpiresAt: time.Now().Add(a.sessionTTL),
+	})
+	if err != nil {
+		logctx.Logger(ctx, a.logger).Error(fmt.Sprintf(`cannot create session: %s`, err))
+		return nil, nil, fmt.Errorf("cannot create session: %w", err)
+	}
+	session.Token = token
+	return session, user, nil
+}
+
+func (a Auth) Logout(ctx context.Context, token string) error {
+	if err := a.ss.Delete(ctx, HashToken(token)); err != nil {
+		logctx.Logger(ctx, a.logger).Error(fmt.Sprintf(`cannot delete session: %s`, err))
+		return fmt.Errorf("cannot delete session: %w", err)
+	}
+	return nil
+}
+
+// Authenticate returns the user of a valid session.
+func (a Auth) Authenticate(ctx context.Context, token string) (*models.User, error) {
+	session, err := a.ss.Read(ctx, HashToken(token))
+	if errors.Is(err, pgdb.ErrNotFound) {
+		return nil, ErrInvalidSession
+	}
+	if err != nil {
+		logctx.Logger(ctx, a.logger).Error(fmt.Sprintf(`cannot read session: %s`, err))
+		return nil, fmt.Errorf("cannot read session: %w", err)
+	}
+	user, err := a.cs.Read(ctx, session.UserId)
+	if err != nil {
+		logctx.Logger(ctx, a.logger).Error(fmt.Sprintf(`cannot read session user: %s`, err))
+		return nil, fmt.Errorf("cannot read session user: %w", err)
+	}
+	if !user.IsActive {
+		return nil, ErrInvalidSession
+	}
+	return user, nil
+}
+
+// IssueToken checks credentials and returns an access token with a new refresh token.
+func (a Auth) IssueToken(ctx context.Context, username, password string) (*models.TokenPair, error) {
+	user, err := a.cs.ReadByCredentials(ctx, username, password)
+	if errors.Is(err, pgdb.ErrNotFound) {
+		logctx.Logger(ctx, a.logger).Warn("token request failed", zap.String("username", username))
+		metrics.LoginsFailed.WithLabelValues("token").Inc()
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		logctx.Logger(ctx, a.logger).Error(fmt.Sprintf(`cannot check credentials: %s`, err))
+		return nil, fmt.Errorf("cannot check credentials: %w", err)
+	}
+	refresh, err := NewToken()
+	if err != nil {
+		return nil, err
+	}
+	_, err = a.rs.Create(ctx, models.RefreshToken{
+		Id:        HashToken(refresh),
+		UserId:    user.Id,
+		ExpiresAt: time.Now().Add(a.refreshTTL),
+	})
+	if err != nil {
+		logctx.Logger(ctx, a.logger).Error(fmt.Sprintf(`cannot create refresh token: %s`, err))
+		return nil, fmt.Errorf("cannot create refresh token: %w", err)
+	}
+	return a.tokenPair(user.Id, refresh)
+}
+
+// RefreshToken exchanges a refresh token for a new pair, the old refresh token is revoked.
+// Reuse of an already rotated token revokes all refresh tokens of the user,
+// as it means the token has leaked.
+func (a Auth) RefreshToken(ctx context.Context, refresh string) (*models.TokenPair, error) {
+	next, err := NewToken()
+	if err != nil {
+		return nil, err
+	}
+	oldID := HashToken(refresh)
+	token, err := a.rs.Rotate(ctx, oldID, HashToken(next), time.Now().Add(a.refreshTTL))
+	if errors.Is(err, pgdb.ErrNotFound) {
+		if old, err := a.rs.Read(ctx, oldID); err == nil && old.RevokedAt != nil {
+			logctx.Logger(ctx, a.logger).Warn("revoked refresh token reused", zap.Int("user_id", old.UserId))
+			if err := a.rs.RevokeByUser(ctx, old.UserId); err != nil {
+				logctx.Logger(ctx, a.logger).Error(fmt.Sprintf(`cannot revoke refresh tokens: %s`, err))
+			}
+		}
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		logctx.Logger(ctx, a.logger).Error(fmt.Sprintf(`cannot rotate refresh token: %s`, err))
+		return nil, fmt.Errorf("cannot rotate refresh token: %w", err)
+	}
+	user, err := a.cs.Read(ctx, token.UserId)
+	if err != nil {
+		logctx.Logger(ctx, a.logger).Error(fmt.Sprintf(`cannot read token user: %s`, err))
+		return nil, fmt.Errorf("cannot read token user: %w", err)
+	}
+	if !user.IsActive {
+		return nil, ErrInvalidToken
+	}
+	return a.tokenPair(token.UserId, next)
+}
+
+// VerifyAccessToken returns the user id of a valid access token.
+func (a Auth) VerifyAccessToken(token string) (int, error) {
+	id, err := a.signer.Verify(token)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	return id, nil
+}
+
+func (a Auth) tokenPair(userID int, refresh string) (*models.TokenPair, error) {
+	access, expiresAt, err := a.signer.Sign(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(expiresAt).Seconds()),
+		RefreshToken: refresh,
+	}, nil
+}
+
+// NewToken returns a random URL-safe token.
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex sha256 of a token, only hashes are stored in DB.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,185 @@
+package categoryrepo
+
+import (
+	"context"
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/slug"
+	"go.uber.org/zap"
+	"strings"
+)
+
+type CategoryCreate interface {
+	Create(ctx context.Context, category models.Category) (int, error)
+}
+
+type CategoryRead interface {
+	Read(ctx context.Context, id int) (*models.Category, error)
+}
+
+type CategoryReadBySlug interface {
+	ReadBySlug(ctx context.Context, slug string) (*models.Category, error)
+}
+
+type CategoryUpdate interface {
+	Update(ctx context.Context, category models.Category, fields ...string) (*models.Category, error)
+}
+
+type CategoryDelete interface {
+	Delete(ctx context.Context, id int) error
+}
+
+type CategoryAll interface {
+	All(ctx context.Context) ([]models.Category, error)
+}
+
+type CategoryIsDescendant interface {
+	IsDescendant(ctx context.Context, id, ancestor int) (bool, error)
+}
+
+type CategoryStorage interface {
+	CategoryCreate
+	CategoryRead
+	CategoryReadBySlug
+	CategoryUpdate
+	CategoryDelete
+	CategoryAll
+	CategoryIsDescendant
+}
+
+type Categories struct {
+	cs     CategoryStorage
+	logger *zap.Logger
+}
+
+func NewCategories(c CategoryStorage, l *zap.Logger) *Categories {
+	return &Categories{
+		cs:     c,
+		logger: l,
+	}
+}
+
+// Create makes the slug of the name unless it is given.
+func (c Categories) Create(ctx context.Context, category models.Category) (*models.Category, error) {
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Slug == "" {
+		category.Slug = slug.Make(category.Name)
+	}
+	if category.Name == "" {
+		err := apperr.Validation("empty_name", "name is empty").WithDetails("field", "name")
+		return nil, err
+	}
+	if err := slug.Check(category.Slug); err != nil {
+		return nil, err
+	}
+	id, err := c.cs.Create(ctx, category)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot create category: %s`, err))
+		return nil, fmt.Errorf("cannot create category: %w", err)
+	}
+	created, err := c.cs.Read(ctx, id)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot read category: %s`, err))
+		return nil, fmt.Errorf("cannot read created category: %w", err)
+	}
+	return created, nil
+}
+
+func (c Categories) Read(ctx context.Context, id int) (*models.Category, error) {
+	category, err := c.cs.Read(ctx, id)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot read category: %s`, err))
+		return nil, fmt.Errorf("cannot read category: %w", err)
+	}
+	return category, nil
+}
+
+func (c Categories) ReadBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	category, err := c.cs.ReadBySlug(ctx, slug)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot read category: %s`, err))
+		return nil, fmt.Errorf("cannot read category: %w", err)
+	}
+	return category, nil
+}
+
+// Update moves a category only under a category outside of its subtree.
+func (c Categories) Update(ctx context.Context, category models.Category, fields ...string) (*models.Category, error) {
+	category.Name = strings.TrimSpace(category.Name)
+	if writes(fields, "name", category.Name != "") && category.Name == "" {
+		err := apperr.Validation("empty_name", "name is empty").WithDetails("field", "name")
+		return nil, err
+	}
+	if writes(fields, "slug", category.Slug != "") {
+		if err := slug.Check(category.Slug); err != nil {
+			return nil, err
+		}
+	}
+	if writes(fields, "parent_id", category.ParentId != 0) && category.ParentId != 0 {
+		cycle, err := c.cs.IsDescendant(ctx, category.ParentId, category.Id)
+		if err != nil {
+			logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot check category parent: %s`, err))
+			return nil, fmt.Errorf("cannot check category parent: %w", err)
+		}
+		if cycle {
+			err := apperr.Validation("category_cycle", "category cannot be moved into its own subtree").
+				WithDetails("field", "parent_id")
+			return nil, err
+		}
+	}
+	updated, err := c.cs.Update(ctx, category, fields...)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot update category: %s`, err))
+		return nil, fmt.Errorf("cannot update category: %w", err)
+	}
+	return updated, nil
+}
+
+func (c Categories) Delete(ctx context.Context, id int) (*models.Category, error) {
+	category, err := c.cs.Read(ctx, id)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot read category: %s`, err))
+		return nil, fmt.Errorf("cannot read category: %w", err)
+	}
+	return category, c.cs.Delete(ctx, id)
+}
+
+// Tree returns root categories with their subcategories.
+func (c Categories) Tree(ctx context.Context) ([]models.CategoryNode, error) {
+	categories, err := c.cs.All(ctx)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot list categories: %s`, err))
+		return nil, fmt.Errorf("cannot list categories: %w", err)
+	}
+	children := make(map[int][]models.Category)
+	for _, category := range categories {
+		children[category.ParentId] = append(children[category.ParentId], category)
+	}
+	var build func(parent int) []models.CategoryNode
+	build = func(parent int) []models.CategoryNode {
+		nodes := make([]models.CategoryNode, 0, len(children[parent]))
+		for _, category := range children[parent] {
+			nodes = append(nodes, models.CategoryNode{
+				Category: category,
+				Children: build(category.Id),
+			})
+		}
+		return nodes
+	}
+	return build(0), nil
+}
+
+// writes reports whether an update writes field, see pgdb.UpdateFromStruct
+func writes(fields []string, field string, nonZero bool) bool {
+	if len(fields) == 0 {
+		return nonZero
+	}
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package commentrepo
+
+import (
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/markup"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+)
+
+// renderBody renders body_html of a comment whose body is written. Clients never write
+// body_html themselves, so it is dropped from fields otherwise.
+func renderBody(comment *models.Comment, fields []string) ([]string, error) {
+	comment.BodyHTML = ""
+	res := make([]string, 0, len(fields)+1)
+	for _, f := range fields {
+		if f != "body_html" {
+			res = append(res, f)
+		}
+	}
+	if !writesBody(*comment, fields) {
+		return res, nil
+	}
+	html, err := markup.Comment(comment.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot render comment body: %w", err)
+	}
+	comment.BodyHTML = html
+	if len(res) > 0 {
+		res = append(res, "body_html")
+	}
+	return res, nil
+}
+
+// writesBody reports whether an update of fields writes the body of comment,
+// all non-zero fields are written without a mask.
+func writesBody(comment models.Comment, fields []string) bool {
+	if len(fields) == 0 {
+		return comment.Body != ""
+	}
+	for _, f := range fields {
+		if f == "body" {
+			return true
+		}
+	}
+	return false
+}
@@ -2,16 +2,19 @@ package commentrepo
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/log"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/config"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"github.com/ptsypyshev/simple-blog/internal/metrics"
 	"github.com/ptsypyshev/simple-blog/internal/models"
 	"go.uber.org/zap"
-	"strconv"
+	"time"
 )
 
 type CommentCreate interface {
-	Create(ctx context.Context, comment models.Comment) (int, error)
+	Create(ctx context.Context, comment models.Comment, spam models.SpamCheck) (int, error)
 }
 
 type CommentRead interface {
@@ -19,7 +22,21 @@ type CommentRead interface {
 }
 
 type CommentUpdate interface {
-	Update(ctx context.Context, comment models.Comment) (*models.Comment, error)
+	// Update stores the result of a new spam check along, unless spam is nil.
+	// A status change is logged with the editor as the moderator.
+	Update(ctx context.Context, comment models.Comment, spam *models.SpamCheck, fields ...string) (*models.Comment, error)
+}
+
+type CommentList interface {
+	List(ctx context.Context, params models.ListParams) ([]models.Comment, *models.Page, error)
+}
+
+type CommentListByPost interface {
+	ListByPost(ctx context.Context, postID int, params models.ListParams) ([]models.Comment, *models.Page, error)
+}
+
+type CommentThread interface {
+	Thread(ctx context.Context, postID int, scope models.ListParams) ([]models.Comment, error)
 }
 
 type CommentDelete interface {
@@ -35,94 +52,191 @@ type CommentStorage interface {
 	CommentRead
 	CommentUpdate
 	CommentDelete
+	CommentList
+	CommentListByPost
+	CommentThread
+	CommentModeration
 	//UserSearch
 }
 
+// SpamFilter scores new comments and learns from decisions of moderators.
+type SpamFilter interface {
+	Check(ctx context.Context, comment models.Comment) (models.SpamCheck, error)
+	Learn(ctx context.Context, comments []models.Comment, spam bool) error
+}
+
 type Comments struct {
 	cs     CommentStorage
+	spam   SpamFilter
+	cfg    config.Comments
 	logger *zap.Logger
-	tracer opentracing.Tracer
 }
 
-func NewComments(c CommentStorage, l *zap.Logger, t opentracing.Tracer) *Comments {
+// NewComments makes comments repository, spam may be nil to skip spam checks.
+func NewComments(c CommentStorage, spam SpamFilter, cfg config.Comments, l *zap.Logger) *Comments {
 	return &Comments{
 		cs:     c,
+		spam:   spam,
+		cfg:    cfg,
 		logger: l,
-		tracer: t,
 	}
 }
 
-func (c Comments) Create(ctx context.Context, comment models.Comment) (*models.Comment, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, c.tracer,
-		"CommentRepo.Create")
-	defer span.Finish()
-	span.LogFields(
-		log.String("Comment request", comment.String()),
-	)
-	id, err := c.cs.Create(ctx, comment)
+// Create keeps the approved status set by the policy for moderators,
+// other comments are approved or sent to moderation by moderationStatus.
+// Comments scored as spam are held for approval anyway.
+func (c Comments) Create(ctx context.Context, comment models.Comment) (_ *models.Comment, err error) {
+	defer metrics.ObserveRepo("comments", "create", time.Now(), &err)
+	comment.Depth = 0
+	if comment.ParentId != 0 {
+		parent, err := c.cs.Read(ctx, comment.ParentId)
+		if errors.Is(err, apperr.ErrNotFound) {
+			err = apperr.Validation("unknown_parent", "the parent comment does not exist").
+				WithDetails("field", "parent_id")
+		}
+		if err == nil {
+			err = checkParent(&comment, *parent)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	trusted := comment.Status == models.CommentApproved
+	if !trusted {
+		status, err := c.moderationStatus(ctx, comment)
+		if err != nil {
+			return nil, err
+		}
+		comment.Status = status
+	}
+	check := c.checkSpam(ctx, comment)
+	if !trusted && check.Score >= c.cfg.SpamThreshold {
+		comment.Status = models.CommentPending
+	}
+	if _, err := renderBody(&comment, nil); err != nil {
+		return nil, err
+	}
+	id, err := c.cs.Create(ctx, comment, check)
 	if err != nil {
-		c.logger.Error(fmt.Sprintf(`cannot read comment: %s`, err))
-		span.LogFields(log.Error(err))
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot create comment: %s`, err))
 		return nil, fmt.Errorf("cannot create comment: %w", err)
 	}
-	comment.Id = id
-	span.LogFields(
-		log.String("Comment result", comment.String()),
-	)
-	return &comment, nil
+	// Timestamps are set by the database, the stored row is returned
+	created, err := c.cs.Read(ctx, id)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot read created comment: %s`, err))
+		return nil, fmt.Errorf("cannot read created comment: %w", err)
+	}
+	return created, nil
 }
 
-func (c Comments) Read(ctx context.Context, id int) (*models.Comment, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, c.tracer,
-		"CommentRepo.Read")
-	defer span.Finish()
-	span.LogFields(
-		log.String("id", strconv.Itoa(id)),
-	)
+func (c Comments) Read(ctx context.Context, id int) (_ *models.Comment, err error) {
+	defer metrics.ObserveRepo("comments", "read", time.Now(), &err)
 	comment, err := c.cs.Read(ctx, id)
 	if err != nil {
-		c.logger.Error(fmt.Sprintf(`cannot read comment: %s`, err))
-		span.LogFields(log.Error(err))
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot read comment: %s`, err))
 		return nil, fmt.Errorf("cannot read comment: %w", err)
 	}
-	span.LogFields(
-		log.String("Comment result", comment.String()),
-	)
 	return comment, nil
 }
 
-func (c Comments) Update(ctx context.Context, updateComment models.Comment) (*models.Comment, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, c.tracer,
-		"CommentRepo.Update")
-	defer span.Finish()
-	span.LogFields(
-		log.String("id", strconv.Itoa(updateComment.Id)),
-		log.String("updateComment", updateComment.String()),
-	)
-	comment, err := c.cs.Update(ctx, updateComment)
+// Update keeps the status of comments on trusted edits, e.g. of moderators. An edited body
+// is checked for spam again. An approved comment whose body is edited by others goes back
+// to moderation if a new comment would wait there or if it is scored as spam, the change
+// is kept in the moderation log. Edits never approve comments.
+func (c Comments) Update(ctx context.Context, updateComment models.Comment, trusted bool, fields ...string) (_ *models.Comment, err error) {
+	defer metrics.ObserveRepo("comments", "update", time.Now(), &err)
+	current, err := c.cs.Read(ctx, updateComment.Id)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot read comment: %s`, err))
+		return nil, fmt.Errorf("cannot read comment: %w", err)
+	}
+	if current.DeletedAt != nil {
+		err := apperr.Conflict("comment_deleted", "a deleted comment cannot be edited")
+		return nil, err
+	}
+	// The status is written only when the comment goes back to moderation
+	updateComment.Status = ""
+	var check *models.SpamCheck
+	if writesBody(updateComment, fields) {
+		edited := *current
+		edited.Body = updateComment.Body
+		spam := c.checkSpam(ctx, edited)
+		check = &spam
+		if !trusted && current.Status == models.CommentApproved {
+			status, err := c.moderationStatus(ctx, edited)
+			if err != nil {
+				return nil, err
+			}
+			if status == models.CommentPending || spam.Score >= c.cfg.SpamThreshold {
+				updateComment.Status = models.CommentPending
+			}
+		}
+	}
+	fields, err = renderBody(&updateComment, fields)
 	if err != nil {
-		c.logger.Error(fmt.Sprintf(`cannot update comment: %s`, err))
-		span.LogFields(log.Error(err))
+		return nil, err
+	}
+	comment, err := c.cs.Update(ctx, updateComment, check, fields...)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot update comment: %s`, err))
 		return nil, fmt.Errorf("cannot update comment: %w", err)
 	}
 	return comment, nil
 }
 
-func (c Comments) Delete(ctx context.Context, id int) (*models.Comment, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, c.tracer,
-		"CommentRepo.Delete")
-	defer span.Finish()
-	span.LogFields(
-		log.String("id", strconv.Itoa(id)),
-	)
+func (c Comments) Delete(ctx context.Context, id int) (_ *models.Comment, err error) {
+	defer metrics.ObserveRepo("comments", "delete", time.Now(), &err)
 	comment, err := c.cs.Read(ctx, id)
 	if err != nil {
-		c.logger.Error(fmt.Sprintf(`cannot read comment: %s`, err))
-		span.LogFields(log.Error(err))
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot read comment: %s`, err))
 		return nil, fmt.Errorf("cannot read comment: %w", err)
 	}
-	span.LogFields(
-		log.String("Comment delete", comment.String()),
-	)
 	return comment, c.cs.Delete(ctx, id)
 }
+
+func (c Comments) List(ctx context.Context, params models.ListParams) (_ []models.Comment, _ *models.Page, err error) {
+	defer metrics.ObserveRepo("comments", "list", time.Now(), &err)
+	comments, page, err := c.cs.List(ctx, params)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot list comments: %s`, err))
+		return nil, nil, fmt.Errorf("cannot list comments: %w", err)
+	}
+	return comments, page, nil
+}
+
+func (c Comments) ListByPost(ctx context.Context, postID int, params models.ListParams) (_ []models.Comment, _ *models.Page, err error) {
+	defer metrics.ObserveRepo("comments", "list_by_post", time.Now(), &err)
+	comments, page, err := c.cs.ListByPost(ctx, postID, params)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot list comments of post: %s`, err))
+		return nil, nil, fmt.Errorf("cannot list comments of post: %w", err)
+	}
+	return comments, page, nil
+}
+
+// Thread returns comments of a post nested into their parents, scope limits
+// them to the ones its viewer may see.
+func (c Comments) Thread(ctx context.Context, postID int, order string, scope models.ListParams) (_ []models.CommentNode, err error) {
+	defer metrics.ObserveRepo("comments", "thread", time.Now(), &err)
+	if err := checkOrder(order); err != nil {
+		return nil, err
+	}
+	comments, err := c.cs.Thread(ctx, postID, scope)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot read comments of post: %s`, err))
+		return nil, fmt.Errorf("cannot read comments of post: %w", err)
+	}
+	return buildThread(comments, order), nil
+}
+
+// FlatThread returns comments of a post in the order of Thread, every comment
+// is followed by its replies.
+func (c Comments) FlatThread(ctx context.Context, postID int, order string, scope models.ListParams) (_ []models.ThreadComment, err error) {
+	defer metrics.ObserveRepo("comments", "flat_thread", time.Now(), &err)
+	nodes, err := c.Thread(ctx, postID, order, scope)
+	if err != nil {
+		return nil, err
+	}
+	return flatten(nodes, nil, make([]models.ThreadComment, 0)), nil
+}
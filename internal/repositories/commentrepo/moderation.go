@@ -0,0 +1,132 @@
+package commentrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"github.com/ptsypyshev/simple-blog/internal/metrics"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"strings"
+	"time"
+)
+
+// MaxModerated is the max number of comments moderated at once
+const MaxModerated = 100
+
+type CommentModeration interface {
+	PostModeration(ctx context.Context, postID int) (*bool, int, error)
+	UserStanding(ctx context.Context, userID int) (int, int, error)
+	Queue(ctx context.Context, status string, params models.ListParams) ([]models.QueuedComment, *models.Page, error)
+	Moderate(ctx context.Context, ids []int, status, reason string) ([]models.Comment, error)
+	ModerationLog(ctx context.Context, params models.ListParams) ([]models.CommentModeration, *models.Page, error)
+}
+
+// moderationStatus approves a new comment unless its post needs approval of comments.
+// Then comments of the post author and of users with enough approved comments and
+// none turned down are approved anyway, others wait in the queue.
+func (c Comments) moderationStatus(ctx context.Context, comment models.Comment) (string, error) {
+	moderate, authorID, err := c.cs.PostModeration(ctx, comment.PostId)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return "", apperr.Validation("unknown_post", "the post does not exist").WithDetails("field", "post_id")
+	}
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot read moderation setting: %s`, err))
+		return "", fmt.Errorf("cannot read moderation setting: %w", err)
+	}
+	if moderate == nil {
+		moderate = &c.cfg.Moderate
+	}
+	if !*moderate || comment.UserId == authorID {
+		return models.CommentApproved, nil
+	}
+	if c.cfg.TrustedAfter > 0 {
+		approved, flagged, err := c.cs.UserStanding(ctx, comment.UserId)
+		if err != nil {
+			logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot read user standing: %s`, err))
+			return "", fmt.Errorf("cannot read user standing: %w", err)
+		}
+		if flagged == 0 && approved >= c.cfg.TrustedAfter {
+			return models.CommentApproved, nil
+		}
+	}
+	return models.CommentPending, nil
+}
+
+// Queue returns a page of comments with the status, pending ones by default.
+func (c Comments) Queue(ctx context.Context, status string, params models.ListParams) (_ []models.QueuedComment, _ *models.Page, err error) {
+	defer metrics.ObserveRepo("comments", "queue", time.Now(), &err)
+	if status == "" {
+		status = models.CommentPending
+	}
+	if !models.ValidCommentStatus(status) {
+		err := unknownStatus(status)
+		return nil, nil, err
+	}
+	comments, page, err := c.cs.Queue(ctx, status, params)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot list moderation queue: %s`, err))
+		return nil, nil, fmt.Errorf("cannot list moderation queue: %w", err)
+	}
+	return comments, page, nil
+}
+
+// Moderate sets the status of comments, the reason is kept in the moderation log.
+func (c Comments) Moderate(ctx context.Context, ids []int, status, reason string) (_ []models.Comment, err error) {
+	defer metrics.ObserveRepo("comments", "moderate", time.Now(), &err)
+	reason = strings.TrimSpace(reason)
+	switch {
+	case len(ids) == 0:
+		err = apperr.Validation("no_comments", "no comments to moderate").WithDetails("field", "ids")
+	case len(ids) > MaxModerated:
+		err = apperr.Validation("too_many_comments", fmt.Sprintf("at most %d comments are moderated at once", MaxModerated)).
+			WithDetails("field", "ids")
+	case !models.ValidCommentStatus(status):
+		err = unknownStatus(status)
+	}
+	if err != nil {
+		return nil, err
+	}
+	comments, err := c.cs.Moderate(ctx, ids, status, reason)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot moderate comments: %s`, err))
+		return nil, fmt.Errorf("cannot moderate comments: %w", err)
+	}
+	// The decision is already made, a failure to learn from it is only logged
+	if c.spam != nil && (status == models.CommentSpam || status == models.CommentApproved) {
+		if err := c.spam.Learn(ctx, comments, status == models.CommentSpam); err != nil {
+			logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot learn moderated comments: %s`, err))
+		}
+	}
+	return comments, nil
+}
+
+func (c Comments) ModerationLog(ctx context.Context, params models.ListParams) (_ []models.CommentModeration, _ *models.Page, err error) {
+	defer metrics.ObserveRepo("comments", "moderation_log", time.Now(), &err)
+	entries, page, err := c.cs.ModerationLog(ctx, params)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot list moderation log: %s`, err))
+		return nil, nil, fmt.Errorf("cannot list moderation log: %w", err)
+	}
+	return entries, page, nil
+}
+
+// checkSpam scores a new or edited comment. A comment which cannot be checked is held
+// for approval rather than published unchecked.
+func (c Comments) checkSpam(ctx context.Context, comment models.Comment) models.SpamCheck {
+	if c.spam == nil {
+		return models.SpamCheck{Reasons: []string{}}
+	}
+	check, err := c.spam.Check(ctx, comment)
+	if err != nil {
+		logctx.Logger(ctx, c.logger).Error(fmt.Sprintf(`cannot check comment for spam: %s`, err))
+		return models.SpamCheck{Score: 1, Reasons: []string{"check failed"}}
+	}
+	return check
+}
+
+func unknownStatus(status string) error {
+	return apperr.Validation("unknown_status", fmt.Sprintf("unknown comment status %q", status)).
+		WithDetails("field", "status")
+}
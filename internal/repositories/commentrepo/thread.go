@@ -0,0 +1,92 @@
+package commentrepo
+
+import (
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"sort"
+)
+
+// MaxDepth is the max depth of a reply, top comments have depth 0
+const MaxDepth = 8
+
+// checkParent makes a comment a reply of parent
+func checkParent(comment *models.Comment, parent models.Comment) error {
+	if comment.PostId == 0 {
+		comment.PostId = parent.PostId
+	}
+	if parent.PostId != comment.PostId {
+		return apperr.Validation("parent_post_mismatch", "the parent comment belongs to another post").
+			WithDetails("field", "parent_id")
+	}
+	if parent.DeletedAt != nil {
+		return apperr.Conflict("parent_deleted", "cannot reply to a deleted comment").
+			WithDetails("field", "parent_id")
+	}
+	if parent.Status != models.CommentApproved {
+		return apperr.Conflict("parent_not_approved", "cannot reply to a comment before it is approved").
+			WithDetails("field", "parent_id")
+	}
+	if parent.Depth+1 > MaxDepth {
+		return apperr.Validation("too_deep", fmt.Sprintf("replies may be nested %d levels deep at most", MaxDepth)).
+			WithDetails("field", "parent_id")
+	}
+	comment.Depth = parent.Depth + 1
+	return nil
+}
+
+func checkOrder(order string) error {
+	switch order {
+	case models.ThreadOldest, models.ThreadNewest, models.ThreadTop:
+		return nil
+	}
+	return apperr.Validation("unknown_sort", fmt.Sprintf("cannot sort by %s", order)).
+		WithDetails("sort", order)
+}
+
+// buildThread nests comments ordered by id. Replies whose parent is missing,
+// e.g. hidden by moderation, are left out with their replies.
+func buildThread(comments []models.Comment, order string) []models.CommentNode {
+	children := make(map[int][]models.Comment)
+	for _, c := range comments {
+		children[c.ParentId] = append(children[c.ParentId], c)
+	}
+	var build func(parent int) ([]models.CommentNode, int)
+	build = func(parent int) ([]models.CommentNode, int) {
+		nodes := make([]models.CommentNode, 0, len(children[parent]))
+		total := 0
+		for _, c := range children[parent] {
+			replies, n := build(c.Id)
+			nodes = append(nodes, models.CommentNode{Comment: c, ReplyCount: n, Replies: replies})
+			total += n + 1
+		}
+		sortNodes(nodes, order)
+		return nodes, total
+	}
+	nodes, _ := build(0)
+	return nodes
+}
+
+func sortNodes(nodes []models.CommentNode, order string) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		switch order {
+		case models.ThreadNewest:
+			return nodes[i].Id > nodes[j].Id
+		case models.ThreadTop:
+			if nodes[i].ReplyCount != nodes[j].ReplyCount {
+				return nodes[i].ReplyCount > nodes[j].ReplyCount
+			}
+		}
+		return nodes[i].Id < nodes[j].Id
+	})
+}
+
+// flatten lists a thread depth-first, every comment goes right before its replies
+func flatten(nodes []models.CommentNode, path []int, res []models.ThreadComment) []models.ThreadComment {
+	for _, node := range nodes {
+		p := append(append(make([]int, 0, len(path)+1), path...), node.Id)
+		res = append(res, models.ThreadComment{Comment: node.Comment, ReplyCount: node.ReplyCount, Path: p})
+		res = flatten(node.Replies, p, res)
+	}
+	return res
+}
@@ -0,0 +1,34 @@
+package postrepo
+
+import (
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/markup"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+)
+
+// renderBody renders body_html of a post whose body is written. Clients never write
+// body_html themselves, so it is dropped from fields otherwise.
+func renderBody(post *models.Post, fields []string) ([]string, error) {
+	post.BodyHTML = ""
+	res := make([]string, 0, len(fields)+1)
+	written := len(fields) == 0 && post.Body != ""
+	for _, f := range fields {
+		if f == "body_html" {
+			continue
+		}
+		written = written || f == "body"
+		res = append(res, f)
+	}
+	if !written {
+		return res, nil
+	}
+	html, err := markup.Post(post.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot render post body: %w", err)
+	}
+	post.BodyHTML = html
+	if len(res) > 0 {
+		res = append(res, "body_html")
+	}
+	return res, nil
+}
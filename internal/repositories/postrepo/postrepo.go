@@ -3,11 +3,12 @@ package postrepo
 import (
 	"context"
 	"fmt"
-	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/log"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"github.com/ptsypyshev/simple-blog/internal/metrics"
 	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/slug"
 	"go.uber.org/zap"
-	"strconv"
+	"time"
 )
 
 type PostCreate interface {
@@ -18,8 +19,42 @@ type PostRead interface {
 	Read(ctx context.Context, id int) (*models.Post, error)
 }
 
+type PostReadBySlug interface {
+	ReadBySlug(ctx context.Context, slug string) (*models.Post, error)
+}
+
 type PostUpdate interface {
-	Update(ctx context.Context, post models.Post) (*models.Post, error)
+	// Update fails with a conflict when from is set and the post status is not from any more
+	Update(ctx context.Context, post models.Post, from string, fields ...string) (*models.Post, error)
+}
+
+type PostList interface {
+	List(ctx context.Context, params models.ListParams) ([]models.Post, *models.Page, error)
+}
+
+type PostListByUser interface {
+	ListByUser(ctx context.Context, userID int, params models.ListParams) ([]models.Post, *models.Page, error)
+}
+
+type PostListByTag interface {
+	ListByTag(ctx context.Context, tag string, params models.ListParams) ([]models.Post, *models.Page, error)
+}
+
+type PostListByCategory interface {
+	ListByCategory(ctx context.Context, category string, params models.ListParams) ([]models.Post, *models.Page, error)
+}
+
+type PostReadExpanded interface {
+	ReadExpanded(ctx context.Context, id int, include models.PostInclude) (*models.PostExpanded, error)
+}
+
+type PostPublishDue interface {
+	PublishDue(ctx context.Context) (int64, error)
+}
+
+type PostRevisions interface {
+	ListRevisions(ctx context.Context, postID int, params models.ListParams) ([]models.PostRevision, *models.Page, error)
+	ReadRevision(ctx context.Context, postID, rev int) (*models.PostRevision, error)
 }
 
 type PostDelete interface {
@@ -33,96 +68,191 @@ type PostDelete interface {
 type PostStorage interface {
 	PostCreate
 	PostRead
+	PostReadBySlug
 	PostUpdate
 	PostDelete
+	PostList
+	PostListByUser
+	PostListByTag
+	PostListByCategory
+	PostReadExpanded
+	PostPublishDue
+	PostRevisions
 	//UserSearch
 }
 
 type Posts struct {
 	ps     PostStorage
 	logger *zap.Logger
-	tracer opentracing.Tracer
 }
 
-func NewPosts(p PostStorage, l *zap.Logger, t opentracing.Tracer) *Posts {
+func NewPosts(p PostStorage, l *zap.Logger) *Posts {
 	return &Posts{
 		ps:     p,
 		logger: l,
-		tracer: t,
 	}
 }
 
-func (p Posts) Create(ctx context.Context, post models.Post) (*models.Post, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, p.tracer,
-		"PostRepo.Create")
-	defer span.Finish()
-	span.LogFields(
-		log.String("Post request", post.String()),
-	)
+func (p Posts) Create(ctx context.Context, post models.Post) (_ *models.Post, err error) {
+	defer metrics.ObserveRepo("posts", "create", time.Now(), &err)
+	// A new post starts as a draft unless it is published or scheduled right away
+	if _, err := applyStatus(models.Post{Status: models.PostDraft}, &post, nil, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := checkTags(post.Tags); err != nil {
+		return nil, err
+	}
+	if post.Slug != "" {
+		if err := slug.Check(post.Slug); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := renderBody(&post, nil); err != nil {
+		return nil, err
+	}
 	id, err := p.ps.Create(ctx, post)
 	if err != nil {
-		p.logger.Error(fmt.Sprintf(`cannot read post: %s`, err))
-		span.LogFields(log.Error(err))
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot create post: %s`, err))
 		return nil, fmt.Errorf("cannot create post: %w", err)
 	}
-	post.Id = id
-	span.LogFields(
-		log.String("Post result", post.String()),
-	)
-	return &post, nil
+	metrics.PostsCreated.Inc()
+	// Timestamps are set by the database, the stored row is returned
+	created, err := p.ps.Read(ctx, id)
+	if err != nil {
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot read created post: %s`, err))
+		return nil, fmt.Errorf("cannot read created post: %w", err)
+	}
+	return created, nil
 }
 
-func (p Posts) Read(ctx context.Context, id int) (*models.Post, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, p.tracer,
-		"PostRepo.Read")
-	defer span.Finish()
-	span.LogFields(
-		log.String("id", strconv.Itoa(id)),
-	)
+func (p Posts) Read(ctx context.Context, id int) (_ *models.Post, err error) {
+	defer metrics.ObserveRepo("posts", "read", time.Now(), &err)
 	post, err := p.ps.Read(ctx, id)
 	if err != nil {
-		p.logger.Error(fmt.Sprintf(`cannot read post: %s`, err))
-		span.LogFields(log.Error(err))
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot read post: %s`, err))
 		return nil, fmt.Errorf("cannot read post: %w", err)
 	}
-	span.LogFields(
-		log.String("Post result", post.String()),
-	)
 	return post, nil
 }
 
-func (p Posts) Update(ctx context.Context, updatePost models.Post) (*models.Post, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, p.tracer,
-		"PostRepo.Update")
-	defer span.Finish()
-	span.LogFields(
-		log.String("id", strconv.Itoa(updatePost.Id)),
-		log.String("updatePost", updatePost.String()),
-	)
-	post, err := p.ps.Update(ctx, updatePost)
+// ReadBySlug returns a post by its current or an old slug.
+func (p Posts) ReadBySlug(ctx context.Context, slug string) (_ *models.Post, err error) {
+	defer metrics.ObserveRepo("posts", "read_by_slug", time.Now(), &err)
+	post, err := p.ps.ReadBySlug(ctx, slug)
+	if err != nil {
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot read post: %s`, err))
+		return nil, fmt.Errorf("cannot read post: %w", err)
+	}
+	return post, nil
+}
+
+func (p Posts) Update(ctx context.Context, updatePost models.Post, fields ...string) (_ *models.Post, err error) {
+	defer metrics.ObserveRepo("posts", "update", time.Now(), &err)
+	// The transition is checked against the status read here, the store refuses
+	// the update if another request changes the status in between
+	var from string
+	if statusChanges(updatePost, fields) {
+		current, err := p.ps.Read(ctx, updatePost.Id)
+		if err != nil {
+			logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot read post: %s`, err))
+			return nil, fmt.Errorf("cannot read post: %w", err)
+		}
+		if fields, err = applyStatus(*current, &updatePost, fields, time.Now()); err != nil {
+			return nil, err
+		}
+		from = current.Status
+	}
+	if err := checkTags(updatePost.Tags); err != nil {
+		return nil, err
+	}
+	// An empty slug is made of the title again
+	if updatePost.Slug != "" {
+		if err := slug.Check(updatePost.Slug); err != nil {
+			return nil, err
+		}
+	}
+	fields, err = renderBody(&updatePost, fields)
+	if err != nil {
+		return nil, err
+	}
+	post, err := p.ps.Update(ctx, updatePost, from, fields...)
 	if err != nil {
-		p.logger.Error(fmt.Sprintf(`cannot update post: %s`, err))
-		span.LogFields(log.Error(err))
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot update post: %s`, err))
 		return nil, fmt.Errorf("cannot update post: %w", err)
 	}
 	return post, nil
 }
 
-func (p Posts) Delete(ctx context.Context, id int) (*models.Post, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, p.tracer,
-		"PostRepo.Delete")
-	defer span.Finish()
-	span.LogFields(
-		log.String("id", strconv.Itoa(id)),
-	)
+func (p Posts) Delete(ctx context.Context, id int) (_ *models.Post, err error) {
+	defer metrics.ObserveRepo("posts", "delete", time.Now(), &err)
 	post, err := p.ps.Read(ctx, id)
 	if err != nil {
-		p.logger.Error(fmt.Sprintf(`cannot read post: %s`, err))
-		span.LogFields(log.Error(err))
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot read post: %s`, err))
 		return nil, fmt.Errorf("cannot read post: %w", err)
 	}
-	span.LogFields(
-		log.String("Post delete", post.String()),
-	)
 	return post, p.ps.Delete(ctx, id)
 }
+
+func (p Posts) List(ctx context.Context, params models.ListParams) (_ []models.Post, _ *models.Page, err error) {
+	defer metrics.ObserveRepo("posts", "list", time.Now(), &err)
+	posts, page, err := p.ps.List(ctx, params)
+	if err != nil {
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot list posts: %s`, err))
+		return nil, nil, fmt.Errorf("cannot list posts: %w", err)
+	}
+	return posts, page, nil
+}
+
+func (p Posts) ListByUser(ctx context.Context, userID int, params models.ListParams) (_ []models.Post, _ *models.Page, err error) {
+	defer metrics.ObserveRepo("posts", "list_by_user", time.Now(), &err)
+	posts, page, err := p.ps.ListByUser(ctx, userID, params)
+	if err != nil {
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot list posts of user: %s`, err))
+		return nil, nil, fmt.Errorf("cannot list posts of user: %w", err)
+	}
+	return posts, page, nil
+}
+
+func (p Posts) ListByTag(ctx context.Context, tag string, params models.ListParams) (_ []models.Post, _ *models.Page, err error) {
+	defer metrics.ObserveRepo("posts", "list_by_tag", time.Now(), &err)
+	posts, page, err := p.ps.ListByTag(ctx, tag, params)
+	if err != nil {
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot list posts of tag: %s`, err))
+		return nil, nil, fmt.Errorf("cannot list posts of tag %s: %w", tag, err)
+	}
+	return posts, page, nil
+}
+
+func (p Posts) ListByCategory(ctx context.Context, category string, params models.ListParams) (_ []models.Post, _ *models.Page, err error) {
+	defer metrics.ObserveRepo("posts", "list_by_category", time.Now(), &err)
+	posts, page, err := p.ps.ListByCategory(ctx, category, params)
+	if err != nil {
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot list posts of category: %s`, err))
+		return nil, nil, fmt.Errorf("cannot list posts of category %s: %w", category, err)
+	}
+	return posts, page, nil
+}
+
+func (p Posts) ReadExpanded(ctx context.Context, id int, include models.PostInclude) (_ *models.PostExpanded, err error) {
+	defer metrics.ObserveRepo("posts", "read_expanded", time.Now(), &err)
+	post, err := p.ps.ReadExpanded(ctx, id, include)
+	if err != nil {
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot read post: %s`, err))
+		return nil, fmt.Errorf("cannot read post: %w", err)
+	}
+	return post, nil
+}
+
+// PublishDue publishes scheduled posts whose time has come.
+func (p Posts) PublishDue(ctx context.Context) (_ int64, err error) {
+	defer metrics.ObserveRepo("posts", "publish_due", time.Now(), &err)
+	n, err := p.ps.PublishDue(ctx)
+	if err != nil {
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot publish scheduled posts: %s`, err))
+		return 0, fmt.Errorf("cannot publish scheduled posts: %w", err)
+	}
+	if n > 0 {
+		logctx.Logger(ctx, p.logger).Info("scheduled posts published", zap.Int64("count", n))
+	}
+	return n, nil
+}
@@ -0,0 +1,114 @@
+package postrepo
+
+import (
+	"context"
+	"fmt"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"github.com/ptsypyshev/simple-blog/internal/metrics"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"strings"
+	"time"
+)
+
+// RestoreFields are the fields a restored revision writes. The status is not restored,
+// it follows the publishing lifecycle, and the slug follows the title.
+var RestoreFields = []string{"title", "body", "category_id", "tags"}
+
+// diffContext is the number of unchanged lines around changes
+const diffContext = 3
+
+func (p Posts) ListRevisions(ctx context.Context, postID int, params models.ListParams) (_ []models.PostRevision, _ *models.Page, err error) {
+	defer metrics.ObserveRepo("posts", "list_revisions", time.Now(), &err)
+	revisions, page, err := p.ps.ListRevisions(ctx, postID, params)
+	if err != nil {
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot list revisions: %s`, err))
+		return nil, nil, fmt.Errorf("cannot list revisions: %w", err)
+	}
+	return revisions, page, nil
+}
+
+func (p Posts) ReadRevision(ctx context.Context, postID, rev int) (_ *models.PostRevision, err error) {
+	defer metrics.ObserveRepo("posts", "read_revision", time.Now(), &err)
+	revision, err := p.ps.ReadRevision(ctx, postID, rev)
+	if err != nil {
+		logctx.Logger(ctx, p.logger).Error(fmt.Sprintf(`cannot read revision: %s`, err))
+		return nil, fmt.Errorf("cannot read revision: %w", err)
+	}
+	return revision, nil
+}
+
+// Diff returns a unified diff of revision from to revision to, both of them
+// are shown as their fields followed by the body.
+func (p Posts) Diff(ctx context.Context, postID, from, to int) (_ *models.PostDiff, err error) {
+	defer metrics.ObserveRepo("posts", "diff", time.Now(), &err)
+	a, err := p.ReadRevision(ctx, postID, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := p.ReadRevision(ctx, postID, to)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(revisionText(*a)),
+		B:        difflib.SplitLines(revisionText(*b)),
+		FromFile: fmt.Sprintf("rev %d", a.Rev),
+		FromDate: a.CreatedAt.Format(time.RFC3339),
+		ToFile:   fmt.Sprintf("rev %d", b.Rev),
+		ToDate:   b.CreatedAt.Format(time.RFC3339),
+		Context:  diffContext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot diff revisions: %w", err)
+	}
+	return &models.PostDiff{
+		PostId: postID,
+		From:   from,
+		To:     to,
+		Diff:   diff,
+	}, nil
+}
+
+// Restore writes the content of a revision to its post, which makes a new revision.
+func (p Posts) Restore(ctx context.Context, postID, rev int) (_ *models.Post, err error) {
+	defer metrics.ObserveRepo("posts", "restore", time.Now(), &err)
+	revision, err := p.ReadRevision(ctx, postID, rev)
+	if err != nil {
+		return nil, err
+	}
+	return p.Update(ctx, revisionPost(*revision), RestoreFields...)
+}
+
+// revisionPost is the post update which restores a revision
+func revisionPost(r models.PostRevision) models.Post {
+	tags := r.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return models.Post{
+		Id:         r.PostId,
+		Title:      r.Title,
+		Body:       r.Body,
+		CategoryId: r.CategoryId,
+		Tags:       tags,
+	}
+}
+
+func revisionText(r models.PostRevision) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Title: %s\n", r.Title)
+	fmt.Fprintf(&b, "Slug: %s\n", r.Slug)
+	fmt.Fprintf(&b, "Status: %s\n", r.Status)
+	if r.PublishedAt != nil {
+		fmt.Fprintf(&b, "Published at: %s\n", r.PublishedAt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "Category: %d\n", r.CategoryId)
+	fmt.Fprintf(&b, "Tags: %s\n", strings.Join(r.Tags, ", "))
+	b.WriteString("\n")
+	b.WriteString(r.Body)
+	if !strings.HasSuffix(r.Body, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
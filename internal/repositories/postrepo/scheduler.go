@@ -0,0 +1,41 @@
+package postrepo
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Scheduler publishes scheduled posts in the background.
+type Scheduler struct {
+	posts    *Posts
+	interval time.Duration
+	logger   *zap.Logger
+}
+
+func NewScheduler(p *Posts, interval time.Duration, l *zap.Logger) *Scheduler {
+	return &Scheduler{
+		posts:    p,
+		interval: interval,
+		logger:   l,
+	}
+}
+
+// Run publishes due posts every interval until ctx is done. Posts are published
+// at most one interval late, errors are logged and retried on the next tick.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.logger.Info("post scheduler started", zap.Duration("interval", s.interval))
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.posts.PublishDue(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Warn("scheduled posts are not published", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			s.logger.Info("post scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
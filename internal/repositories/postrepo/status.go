@@ -0,0 +1,103 @@
+package postrepo
+
+import (
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"time"
+)
+
+// transitions lists the statuses a post may move to from each status
+var transitions = map[string][]string{
+	models.PostDraft:     {models.PostScheduled, models.PostPublished, models.PostArchived},
+	models.PostScheduled: {models.PostDraft, models.PostPublished, models.PostArchived},
+	models.PostPublished: {models.PostArchived},
+	models.PostArchived:  {models.PostDraft, models.PostPublished},
+}
+
+// CanTransition reports whether a post may move from one status to another.
+func CanTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// applyStatus checks the status change of post from current and sets published_at:
+// publishing stamps the current time, scheduling needs a time in the future.
+// It returns the update mask extended with the status fields.
+func applyStatus(current models.Post, post *models.Post, fields []string, now time.Time) ([]string, error) {
+	to := post.Status
+	if to == "" {
+		to = current.Status
+	}
+	if !models.ValidPostStatus(to) {
+		return nil, apperr.Validation("unknown_status", fmt.Sprintf("unknown post status %q", to)).
+			WithDetails("field", "status")
+	}
+	if !CanTransition(current.Status, to) {
+		return nil, apperr.Validation("invalid_transition", fmt.Sprintf("cannot change post status from %s to %s", current.Status, to)).
+			WithDetails("from", current.Status).
+			WithDetails("to", to)
+	}
+
+	at := post.PublishedAt
+	if at == nil {
+		at = current.PublishedAt
+	}
+	switch to {
+	case models.PostPublished:
+		if current.Status != models.PostPublished || at == nil {
+			at = &now
+		}
+	case models.PostScheduled:
+		if at == nil || !at.After(now) {
+			return nil, apperr.Validation("bad_schedule", "scheduled post needs published_at in the future").
+				WithDetails("field", "published_at")
+		}
+	case models.PostDraft:
+		at = nil
+	}
+	post.Status = to
+	post.PublishedAt = at
+
+	if len(fields) == 0 {
+		return fields, nil
+	}
+	return withFields(fields, "status", "published_at"), nil
+}
+
+// statusChanges reports whether an update touches status fields
+func statusChanges(post models.Post, fields []string) bool {
+	if len(fields) == 0 {
+		return post.Status != "" || post.PublishedAt != nil
+	}
+	for _, f := range fields {
+		if f == "status" || f == "published_at" {
+			return true
+		}
+	}
+	return false
+}
+
+func withFields(fields []string, add ...string) []string {
+	res := append([]string{}, fields...)
+	for _, a := range add {
+		found := false
+		for _, f := range fields {
+			if f == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, a)
+		}
+	}
+	return res
+}
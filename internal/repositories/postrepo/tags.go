@@ -0,0 +1,25 @@
+package postrepo
+
+import (
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/slug"
+)
+
+// MaxTags is the max number of tags of a post
+const MaxTags = 20
+
+// checkTags makes sure every tag has a slug
+func checkTags(tags []string) error {
+	if len(tags) > MaxTags {
+		return apperr.Validation("too_many_tags", fmt.Sprintf("a post may have at most %d tags", MaxTags)).
+			WithDetails("field", "tags")
+	}
+	for _, tag := range tags {
+		if slug.Make(tag) == "" {
+			return apperr.Validation("bad_tag", fmt.Sprintf("tag %q has no letters or digits", tag)).
+				WithDetails("field", "tags")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package searchrepo
+
+import (
+	"context"
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"go.uber.org/zap"
+	"strings"
+)
+
+type SearchFind interface {
+	Search(ctx context.Context, params models.SearchParams) ([]models.SearchResult, *models.Page, error)
+}
+
+type SearchSetLanguage interface {
+	SetLanguage(ctx context.Context, language string) (bool, error)
+}
+
+type SearchStorage interface {
+	SearchFind
+	SearchSetLanguage
+}
+
+type Search struct {
+	ss     SearchStorage
+	logger *zap.Logger
+}
+
+func NewSearch(s SearchStorage, l *zap.Logger) *Search {
+	return &Search{
+		ss:     s,
+		logger: l,
+	}
+}
+
+func (s Search) Search(ctx context.Context, params models.SearchParams) ([]models.SearchResult, *models.Page, error) {
+	params.Query = strings.TrimSpace(params.Query)
+	if params.Query == "" {
+		err := apperr.Validation("empty_query", "search query is empty").WithDetails("param", "q")
+		return nil, nil, err
+	}
+	switch params.Type {
+	case "", models.SearchPost, models.SearchComment:
+	default:
+		err := apperr.Validation("unknown_type", fmt.Sprintf("cannot search %q", params.Type)).
+			WithDetails("param", "type")
+		return nil, nil, err
+	}
+	if params.From != nil && params.To != nil && !params.From.Before(*params.To) {
+		err := apperr.Validation("bad_period", "from must be before to").WithDetails("param", "from")
+		return nil, nil, err
+	}
+	results, page, err := s.ss.Search(ctx, params)
+	if err != nil {
+		logctx.Logger(ctx, s.logger).Error(fmt.Sprintf(`cannot search: %s`, err))
+		return nil, nil, fmt.Errorf("cannot search: %w", err)
+	}
+	return results, page, nil
+}
+
+// SetLanguage makes language the text search language, vectors of existing
+// posts and comments are rebuilt when it changes.
+func (s Search) SetLanguage(ctx context.Context, language string) error {
+	rebuilt, err := s.ss.SetLanguage(ctx, language)
+	if err != nil {
+		logctx.Logger(ctx, s.logger).Error(fmt.Sprintf(`cannot set search language: %s`, err))
+		return fmt.Errorf("cannot set search language %s: %w", language, err)
+	}
+	if rebuilt {
+		logctx.Logger(ctx, s.logger).Info("search index is rebuilt", zap.String("language", language))
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package spamrepo
+
+import (
+	"context"
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/config"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"go.uber.org/zap"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Scores of single signals, they are combined as independent probabilities
+const (
+	// LinkScore is added by every link over the allowed number
+	LinkScore    = 0.3
+	MaxLinkScore = 0.9
+	BlockScore   = 0.9
+	DupScore     = 0.6
+)
+
+// TokenCount is the number of spam and ham comments with a token
+type TokenCount struct {
+	Spam int
+	Ham  int
+}
+
+type SpamDuplicates interface {
+	Duplicates(ctx context.Context, body string, since time.Time, commentID int) (int, error)
+}
+
+type SpamTokens interface {
+	Tokens(ctx context.Context, tokens []string) (map[string]TokenCount, error)
+	Trained(ctx context.Context) (TokenCount, error)
+}
+
+type SpamLearn interface {
+	Learn(ctx context.Context, commentID int, tokens []string, spam bool) error
+}
+
+type SpamStorage interface {
+	SpamDuplicates
+	SpamTokens
+	SpamLearn
+}
+
+// Scorer is the built-in spam filter of comments.
+type Scorer struct {
+	ss        SpamStorage
+	cfg       config.Spam
+	blocklist *Blocklist
+	logger    *zap.Logger
+}
+
+// NewScorer reads the blocklist file of cfg if there is one.
+func NewScorer(s SpamStorage, cfg config.Spam, l *zap.Logger) (*Scorer, error) {
+	blocklist := &Blocklist{}
+	if cfg.BlocklistFile != "" {
+		var err error
+		if blocklist, err = LoadBlocklist(cfg.BlocklistFile); err != nil {
+			return nil, err
+		}
+	}
+	return &Scorer{
+		ss:        s,
+		cfg:       cfg,
+		blocklist: blocklist,
+		logger:    l,
+	}, nil
+}
+
+// Check scores a new or edited comment by its links, blocked words and domains, recent
+// comments with the same body and the classifier trained by moderators. An edited
+// comment is not a duplicate of itself.
+func (s Scorer) Check(ctx context.Context, comment models.Comment) (models.SpamCheck, error) {
+	check := models.SpamCheck{Reasons: make([]string, 0)}
+	add := func(score float64, reason string) {
+		check.Score = 1 - (1-check.Score)*(1-score)
+		check.Reasons = append(check.Reasons, reason)
+	}
+
+	links := findLinks(comment.Body)
+	if extra := len(links) - s.cfg.AllowedLinks; extra > 0 {
+		add(math.Min(LinkScore*float64(extra), MaxLinkScore), "links: "+strconv.Itoa(len(links)))
+	}
+	if entry, ok := s.blocklist.Match(comment.Body, links); ok {
+		add(BlockScore, "blocklist: "+entry)
+	}
+	dups, err := s.ss.Duplicates(ctx, comment.Body, time.Now().Add(-s.cfg.DuplicateWindow.Duration), comment.Id)
+	if err != nil {
+		logctx.Logger(ctx, s.logger).Error(fmt.Sprintf(`cannot look for duplicates: %s`, err))
+		return check, fmt.Errorf("cannot look for duplicates: %w", err)
+	}
+	if dups > 0 {
+		add(DupScore, "duplicates: "+strconv.Itoa(dups))
+	}
+	p, ok, err := s.classify(ctx, comment.Body)
+	if err != nil {
+		logctx.Logger(ctx, s.logger).Error(fmt.Sprintf(`cannot classify comment: %s`, err))
+		return check, fmt.Errorf("cannot classify comment: %w", err)
+	}
+	// The classifier only raises scores, ham-looking comments are judged by other signals
+	if ok && p > 0.5 {
+		add(p, "classifier: "+strconv.FormatFloat(p, 'f', 2, 64))
+	}
+	return check, nil
+}
+
+// classify returns the probability of spam by naive Bayes over tokens of the body.
+// It reports false until the classifier has learned enough comments of both kinds.
+func (s Scorer) classify(ctx context.Context, body string) (float64, bool, error) {
+	trained, err := s.ss.Trained(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	if trained.Spam < s.cfg.MinTraining || trained.Ham < s.cfg.MinTraining {
+		return 0, false, nil
+	}
+	counts, err := s.ss.Tokens(ctx, Tokenize(body))
+	if err != nil {
+		return 0, false, err
+	}
+	// Log probabilities with Laplace smoothing, unknown tokens tell nothing
+	logSpam := math.Log(float64(trained.Spam) / float64(trained.Spam+trained.Ham))
+	logHam := math.Log(float64(trained.Ham) / float64(trained.Spam+trained.Ham))
+	for _, c := range counts {
+		logSpam += math.Log(float64(c.Spam+1) / float64(trained.Spam+2))
+		logHam += math.Log(float64(c.Ham+1) / float64(trained.Ham+2))
+	}
+	return 1 / (1 + math.Exp(logHam-logSpam)), true, nil
+}
+
+// Learn trains the classifier with comments marked as spam or approved by a moderator.
+// A comment learned before is unlearned first, so changed decisions are not counted twice.
+func (s Scorer) Learn(ctx context.Context, comments []models.Comment, spam bool) error {
+	for _, comment := range comments {
+		// Tombstones have no body of their own
+		if comment.DeletedAt != nil {
+			continue
+		}
+		if err := s.ss.Learn(ctx, comment.Id, Tokenize(comment.Body), spam); err != nil {
+			logctx.Logger(ctx, s.logger).Error(fmt.Sprintf(`cannot learn comment: %s`, err))
+			return fmt.Errorf("cannot learn comment %d: %w", comment.Id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package spamrepo
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Tokens shorter or longer than these are not learned
+const (
+	MinTokenLen = 2
+	MaxTokenLen = 32
+)
+
+// linkRe matches plain, Markdown and HTML links
+var linkRe = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>()\[\]"']+`)
+
+// findLinks returns hosts of links of a body
+func findLinks(body string) []string {
+	var hosts []string
+	for _, link := range linkRe.FindAllString(body, -1) {
+		// Punctuation after a link ends the sentence
+		link = strings.TrimRight(link, ".,;:!?")
+		if !strings.Contains(strings.ToLower(link), "://") {
+			link = "http://" + link
+		}
+		u, err := url.Parse(link)
+		host := ""
+		if err == nil {
+			host = strings.ToLower(u.Hostname())
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// Tokenize returns sorted unique lowercase words of a body and "host:" tokens of its links.
+func Tokenize(body string) []string {
+	seen := make(map[string]bool)
+	for _, host := range findLinks(body) {
+		if host != "" {
+			seen["host:"+host] = true
+		}
+	}
+	words := strings.FieldsFunc(strings.ToLower(body), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if n := len([]rune(w)); n >= MinTokenLen && n <= MaxTokenLen {
+			seen[w] = true
+		}
+	}
+	tokens := make([]string, 0, len(seen))
+	for t := range seen {
+		tokens = append(tokens, t)
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// Blocklist holds blocked words, phrases and domains. Domains block their subdomains too.
+type Blocklist struct {
+	words   map[string]bool
+	phrases []string
+	domains []string
+}
+
+// LoadBlocklist reads a blocklist file. Every line is a word, a phrase if it has spaces,
+// or a domain if it has dots. Empty lines and lines starting with # are skipped.
+func LoadBlocklist(path string) (*Blocklist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read blocklist: %w", err)
+	}
+	defer f.Close()
+	b := &Blocklist{words: make(map[string]bool)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		switch {
+		case entry == "" || strings.HasPrefix(entry, "#"):
+		case strings.Contains(entry, " "):
+			b.phrases = append(b.phrases, strings.Join(strings.Fields(entry), " "))
+		case strings.Contains(entry, "."):
+			b.domains = append(b.domains, strings.TrimPrefix(entry, "."))
+		default:
+			b.words[entry] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read blocklist: %w", err)
+	}
+	return b, nil
+}
+
+// Match returns the first blocked entry found in a body or hosts of its links.
+func (b *Blocklist) Match(body string, hosts []string) (string, bool) {
+	for _, host := range hosts {
+		for _, d := range b.domains {
+			if host == d || strings.HasSuffix(host, "."+d) {
+				return d, true
+			}
+		}
+	}
+	for _, t := range Tokenize(body) {
+		if b.words[t] {
+			return t, true
+		}
+	}
+	text := strings.Join(strings.Fields(strings.ToLower(body)), " ")
+	for _, p := range b.phrases {
+		if strings.Contains(text, p) {
+			return p, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,159 @@
+package tagrepo
+
+import (
+	"context"
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"github.com/ptsypyshev/simple-blog/internal/models"
+	"github.com/ptsypyshev/simple-blog/internal/slug"
+	"go.uber.org/zap"
+	"strings"
+)
+
+type TagCreate interface {
+	Create(ctx context.Context, tag models.Tag) (int, error)
+}
+
+type TagRead interface {
+	Read(ctx context.Context, id int) (*models.Tag, error)
+}
+
+type TagReadBySlug interface {
+	ReadBySlug(ctx context.Context, slug string) (*models.Tag, error)
+}
+
+type TagUpdate interface {
+	Update(ctx context.Context, tag models.Tag, fields ...string) (*models.Tag, error)
+}
+
+type TagList interface {
+	List(ctx context.Context, params models.ListParams) ([]models.Tag, *models.Page, error)
+}
+
+type TagDelete interface {
+	Delete(ctx context.Context, id int) error
+}
+
+type TagStorage interface {
+	TagCreate
+	TagRead
+	TagReadBySlug
+	TagUpdate
+	TagDelete
+	TagList
+}
+
+type Tags struct {
+	ts     TagStorage
+	logger *zap.Logger
+}
+
+func NewTags(t TagStorage, l *zap.Logger) *Tags {
+	return &Tags{
+		ts:     t,
+		logger: l,
+	}
+}
+
+// Create makes the slug of the name unless it is given.
+func (t Tags) Create(ctx context.Context, tag models.Tag) (*models.Tag, error) {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Slug == "" {
+		tag.Slug = slug.Make(tag.Name)
+	}
+	if err := checkName(tag.Name); err != nil {
+		return nil, err
+	}
+	if err := slug.Check(tag.Slug); err != nil {
+		return nil, err
+	}
+	id, err := t.ts.Create(ctx, tag)
+	if err != nil {
+		logctx.Logger(ctx, t.logger).Error(fmt.Sprintf(`cannot create tag: %s`, err))
+		return nil, fmt.Errorf("cannot create tag: %w", err)
+	}
+	created, err := t.ts.Read(ctx, id)
+	if err != nil {
+		logctx.Logger(ctx, t.logger).Error(fmt.Sprintf(`cannot read tag: %s`, err))
+		return nil, fmt.Errorf("cannot read created tag: %w", err)
+	}
+	return created, nil
+}
+
+func (t Tags) Read(ctx context.Context, id int) (*models.Tag, error) {
+	tag, err := t.ts.Read(ctx, id)
+	if err != nil {
+		logctx.Logger(ctx, t.logger).Error(fmt.Sprintf(`cannot read tag: %s`, err))
+		return nil, fmt.Errorf("cannot read tag: %w", err)
+	}
+	return tag, nil
+}
+
+func (t Tags) ReadBySlug(ctx context.Context, slug string) (*models.Tag, error) {
+	tag, err := t.ts.ReadBySlug(ctx, slug)
+	if err != nil {
+		logctx.Logger(ctx, t.logger).Error(fmt.Sprintf(`cannot read tag: %s`, err))
+		return nil, fmt.Errorf("cannot read tag: %w", err)
+	}
+	return tag, nil
+}
+
+// Update keeps the slug when the name changes, so links to the tag stay valid.
+func (t Tags) Update(ctx context.Context, tag models.Tag, fields ...string) (*models.Tag, error) {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if writes(fields, "name", tag.Name != "") {
+		if err := checkName(tag.Name); err != nil {
+			return nil, err
+		}
+	}
+	if writes(fields, "slug", tag.Slug != "") {
+		if err := slug.Check(tag.Slug); err != nil {
+			return nil, err
+		}
+	}
+	updated, err := t.ts.Update(ctx, tag, fields...)
+	if err != nil {
+		logctx.Logger(ctx, t.logger).Error(fmt.Sprintf(`cannot update tag: %s`, err))
+		return nil, fmt.Errorf("cannot update tag: %w", err)
+	}
+	return updated, nil
+}
+
+func (t Tags) Delete(ctx context.Context, id int) (*models.Tag, error) {
+	tag, err := t.ts.Read(ctx, id)
+	if err != nil {
+		logctx.Logger(ctx, t.logger).Error(fmt.Sprintf(`cannot read tag: %s`, err))
+		return nil, fmt.Errorf("cannot read tag: %w", err)
+	}
+	return tag, t.ts.Delete(ctx, id)
+}
+
+func (t Tags) List(ctx context.Context, params models.ListParams) ([]models.Tag, *models.Page, error) {
+	tags, page, err := t.ts.List(ctx, params)
+	if err != nil {
+		logctx.Logger(ctx, t.logger).Error(fmt.Sprintf(`cannot list tags: %s`, err))
+		return nil, nil, fmt.Errorf("cannot list tags: %w", err)
+	}
+	return tags, page, nil
+}
+
+func checkName(name string) error {
+	if name == "" {
+		return apperr.Validation("empty_name", "name is empty").WithDetails("field", "name")
+	}
+	return nil
+}
+
+// writes reports whether an update writes field, see pgdb.UpdateFromStruct
+func writes(fields []string, field string, nonZero bool) bool {
+	if len(fields) == 0 {
+		return nonZero
+	}
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
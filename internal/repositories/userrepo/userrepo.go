@@ -3,11 +3,11 @@ package userrepo
 import (
 	"context"
 	"fmt"
-	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/log"
+	"github.com/ptsypyshev/simple-blog/internal/logctx"
+	"github.com/ptsypyshev/simple-blog/internal/metrics"
 	"github.com/ptsypyshev/simple-blog/internal/models"
 	"go.uber.org/zap"
-	"strconv"
+	"time"
 )
 
 type UserCreate interface {
@@ -19,7 +19,11 @@ type UserRead interface {
 }
 
 type UserUpdate interface {
-	Update(ctx context.Context, user models.User) (*models.User, error)
+	Update(ctx context.Context, user models.User, fields ...string) (*models.User, error)
+}
+
+type UserList interface {
+	List(ctx context.Context, params models.ListParams) ([]models.User, *models.Page, error)
 }
 
 type UserDelete interface {
@@ -35,94 +39,77 @@ type UserStorage interface {
 	UserRead
 	UserUpdate
 	UserDelete
+	UserList
 	//UserSearch
 }
 
 type Users struct {
 	us     UserStorage
 	logger *zap.Logger
-	tracer opentracing.Tracer
 }
 
-func NewUsers(u UserStorage, l *zap.Logger, t opentracing.Tracer) *Users {
+func NewUsers(u UserStorage, l *zap.Logger) *Users {
 	return &Users{
 		us:     u,
 		logger: l,
-		tracer: t,
 	}
 }
 
-func (u Users) Create(ctx context.Context, user models.User) (*models.User, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, u.tracer,
-		"UserRepo.Create")
-	defer span.Finish()
-	span.LogFields(
-		log.String("User request", user.String()),
-	)
+func (u Users) Create(ctx context.Context, user models.User) (_ *models.User, err error) {
+	defer metrics.ObserveRepo("users", "create", time.Now(), &err)
+	if user.Role == "" {
+		user.Role = models.RoleCommenter
+	}
 	id, err := u.us.Create(ctx, user)
 	if err != nil {
-		u.logger.Error(fmt.Sprintf(`cannot read user: %s`, err))
-		span.LogFields(log.Error(err))
+		logctx.Logger(ctx, u.logger).Error(fmt.Sprintf(`cannot create user: %s`, err))
 		return nil, fmt.Errorf("cannot create user: %w", err)
 	}
-	user.Id = id
-	span.LogFields(
-		log.String("User result", user.String()),
-	)
-	return &user, nil
+	// Timestamps are set by the database, the stored row is returned
+	created, err := u.us.Read(ctx, id)
+	if err != nil {
+		logctx.Logger(ctx, u.logger).Error(fmt.Sprintf(`cannot read created user: %s`, err))
+		return nil, fmt.Errorf("cannot read created user: %w", err)
+	}
+	return created, nil
 }
 
-func (u Users) Read(ctx context.Context, id int) (*models.User, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, u.tracer,
-		"UserRepo.Read")
-	defer span.Finish()
-	span.LogFields(
-		log.String("id", strconv.Itoa(id)),
-	)
+func (u Users) Read(ctx context.Context, id int) (_ *models.User, err error) {
+	defer metrics.ObserveRepo("users", "read", time.Now(), &err)
 	user, err := u.us.Read(ctx, id)
 	if err != nil {
-		u.logger.Error(fmt.Sprintf(`cannot read user: %s`, err))
-		span.LogFields(log.Error(err))
+		logctx.Logger(ctx, u.logger).Error(fmt.Sprintf(`cannot read user: %s`, err))
 		return nil, fmt.Errorf("cannot read user: %w", err)
 	}
-	span.LogFields(
-		log.String("User result", user.String()),
-	)
 	return user, nil
 }
 
-func (u Users) Update(ctx context.Context, updateUser models.User) (*models.User, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, u.tracer,
-		"UserRepo.Update")
-	defer span.Finish()
-	span.LogFields(
-		log.String("id", strconv.Itoa(updateUser.Id)),
-		log.String("updateUser", updateUser.String()),
-	)
-	user, err := u.us.Update(ctx, updateUser)
+func (u Users) Update(ctx context.Context, updateUser models.User, fields ...string) (_ *models.User, err error) {
+	defer metrics.ObserveRepo("users", "update", time.Now(), &err)
+	user, err := u.us.Update(ctx, updateUser, fields...)
 	if err != nil {
-		u.logger.Error(fmt.Sprintf(`cannot update user: %s`, err))
-		span.LogFields(log.Error(err))
+		logctx.Logger(ctx, u.logger).Error(fmt.Sprintf(`cannot update user: %s`, err))
 		return nil, fmt.Errorf("cannot update user: %w", err)
 	}
 	return user, nil
 }
 
-func (u Users) Delete(ctx context.Context, id int) (*models.User, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, u.tracer,
-		"UserRepo.Delete")
-	defer span.Finish()
-	span.LogFields(
-		log.String("id", strconv.Itoa(id)),
-	)
+func (u Users) Delete(ctx context.Context, id int) (_ *models.User, err error) {
+	defer metrics.ObserveRepo("users", "delete", time.Now(), &err)
 	user, err := u.us.Read(ctx, id)
 	if err != nil {
-		u.logger.Error(fmt.Sprintf(`cannot read user: %s`, err))
-		span.LogFields(log.Error(err))
+		logctx.Logger(ctx, u.logger).Error(fmt.Sprintf(`cannot read user: %s`, err))
 		return nil, fmt.Errorf("cannot read user: %w", err)
 	}
-	span.LogFields(
-		log.String("User delete", user.String()),
-	)
 	return user, u.us.Delete(ctx, id)
 }
+
+func (u Users) List(ctx context.Context, params models.ListParams) (_ []models.User, _ *models.Page, err error) {
+	defer metrics.ObserveRepo("users", "list", time.Now(), &err)
+	users, page, err := u.us.List(ctx, params)
+	if err != nil {
+		logctx.Logger(ctx, u.logger).Error(fmt.Sprintf(`cannot list users: %s`, err))
+		return nil, nil, fmt.Errorf("cannot list users: %w", err)
+	}
+	return users, page, nil
+}
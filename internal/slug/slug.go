@@ -0,0 +1,80 @@
+// Package slug makes URL-friendly identifiers of names, e.g. "Go & Postgres" becomes "go-postgres"
+// and "Привет, мир" becomes "privet-mir".
+package slug
+
+import (
+	"fmt"
+	"github.com/ptsypyshev/simple-blog/internal/apperr"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength is the max length of a slug in bytes, longer slugs are cut at a word boundary
+const MaxLength = 100
+
+// translit maps Cyrillic letters to Latin ones in the way Russian URLs usually spell them,
+// with a few Ukrainian and Belarusian letters. Hard and soft signs are dropped.
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "u",
+}
+
+// Make lowercases s, transliterates Cyrillic and joins its words of letters and digits with hyphens.
+func Make(s string) string {
+	var (
+		b    strings.Builder
+		dash bool
+	)
+	for _, r := range strings.ToLower(s) {
+		t, ok := translit[r]
+		switch {
+		case ok && t == "":
+			continue
+		case !ok && !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			dash = b.Len() > 0
+			continue
+		}
+		if dash {
+			b.WriteByte('-')
+			dash = false
+		}
+		if ok {
+			b.WriteString(t)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return cut(b.String())
+}
+
+// Valid reports whether s is a slug, i.e. Make(s) == s.
+func Valid(s string) bool {
+	return s != "" && Make(s) == s
+}
+
+// Check returns a validation error if s is not a slug.
+func Check(s string) error {
+	if !Valid(s) {
+		return apperr.Validation("bad_slug", fmt.Sprintf("bad slug %q", s)).WithDetails("field", "slug")
+	}
+	return nil
+}
+
+func cut(s string) string {
+	if len(s) <= MaxLength {
+		return s
+	}
+	if i := strings.LastIndexByte(s[:MaxLength+1], '-'); i > 0 {
+		return s[:i]
+	}
+	// A single long word is cut at a rune boundary
+	i := MaxLength
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return s[:i]
+}